@@ -1,25 +1,42 @@
 package admin
 
 import (
+	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/internal/catalogfile"
+	"github.com/Shresth92/audiophile/internal/imaging"
+	"github.com/Shresth92/audiophile/internal/storage"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
 	"github.com/Shresth92/audiophile/responseerror"
 	"github.com/Shresth92/audiophile/services"
-	"github.com/Shresth92/audiophile/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 	"io"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 type Controller struct {
-	adminService services.AdminServices
+	adminService    services.AdminServices
+	reviewService   services.ReviewServices
+	questionService services.QuestionServices
+	imageURLs       *storage.ImageURLService
 }
 
-func NewController(adminService services.AdminServices) *Controller {
-	return &Controller{adminService: adminService}
+func NewController(
+	adminService services.AdminServices,
+	reviewService services.ReviewServices,
+	questionService services.QuestionServices,
+	imageURLs *storage.ImageURLService) *Controller {
+	return &Controller{
+		adminService:    adminService,
+		reviewService:   reviewService,
+		questionService: questionService,
+		imageURLs:       imageURLs,
+	}
 }
 
 func (c *Controller) CreateProduct(ctx *gin.Context) {
@@ -30,6 +47,10 @@ func (c *Controller) CreateProduct(ctx *gin.Context) {
 	}
 
 	productID, productErr := c.adminService.CreateProduct(&productDetails)
+	if errors.Is(productErr, models.ErrInvalidAttribute) {
+		responseerror.RespondClientErr(ctx, productErr, http.StatusBadRequest, productErr.Error())
+		return
+	}
 	if productErr != nil {
 		logrus.Errorf("CreateProduct: error in creating product err = %v", productErr)
 		responseerror.RespondGenericServerErr(ctx, productErr, "error in creating products")
@@ -81,48 +102,47 @@ func (c *Controller) CreateVariant(ctx *gin.Context) {
 }
 
 func (c *Controller) UploadImages(ctx *gin.Context) {
-	client := models.FirebaseClient
-
-	file, fileHeader, err := ctx.Request.FormFile("image")
+	// room for the multipart framing around the largest accepted file
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, imaging.MaxUploadSize+1<<20)
+	err := ctx.Request.ParseMultipartForm(imaging.MaxUploadSize)
 	if err != nil {
 		logrus.Errorf("UploadImages: error in parsing multipart form err = %v", err)
 		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing image")
 		return
 	}
 
-	err = ctx.Request.ParseMultipartForm(10 << 20)
+	file, _, err := ctx.Request.FormFile("image")
 	if err != nil {
 		logrus.Errorf("UploadImages: error in parsing multipart form err = %v", err)
 		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing image")
 		return
 	}
-
 	defer file.Close()
-	imagePath := fileHeader.Filename + strconv.Itoa(int(time.Now().Unix()))
-	bucket := utils.GetEnvValue("firebaseBucket")
-	bucketStorage := client.Storage.Bucket(bucket).Object(imagePath).NewWriter(client.Ctx)
 
-	_, err = io.Copy(bucketStorage, file)
+	data, err := io.ReadAll(io.LimitReader(file, imaging.MaxUploadSize+1))
 	if err != nil {
-		logrus.Errorf("UploadImages: error in file copying err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in copying image")
+		logrus.Errorf("UploadImages: error in reading image err = %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in reading image")
 		return
 	}
 
-	imageId, imageUploadErr := c.adminService.UploadImageFirebase(bucket, imagePath)
-	if imageUploadErr != nil {
-		logrus.Errorf("UploadImages: error in uploading image to firebase err = %v", imageUploadErr)
-		responseerror.RespondGenericServerErr(ctx, imageUploadErr, "error in uploading images")
+	image, renditions, err := c.adminService.UploadImage(ctx.Request.Context(), data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		responseerror.RespondClientErr(ctx, err, http.StatusRequestEntityTooLarge, err.Error())
 		return
 	}
-
-	if bucketErr := bucketStorage.Close(); err != nil {
-		logrus.Errorf("UploadImages: error in closing firebase bucket err = %v", bucketErr)
-		responseerror.RespondGenericServerErr(ctx, bucketErr, "error in closing firebase bucket")
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		responseerror.RespondClientErr(ctx, err, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("UploadImages: error in uploading image err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in uploading images")
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, imageId)
+	urls := c.imageURLs.Images([]models.Images{image}, map[string][]models.ImageRendition{image.Id: renditions})
+	ctx.JSON(http.StatusCreated, urls[image.Id])
 }
 
 func (c *Controller) CreateCategory(ctx *gin.Context) {
@@ -132,7 +152,10 @@ func (c *Controller) CreateCategory(ctx *gin.Context) {
 		return
 	}
 
-	categoryErr := c.adminService.CreateCategory(categoryDetails.CategoryName)
+	categoryErr := c.adminService.CreateCategory(&categoryDetails)
+	if respondTaxonomyErr(ctx, categoryErr) {
+		return
+	}
 	if categoryErr != nil {
 		logrus.Errorf("CreateCategory: error in creating category err: %v", categoryErr)
 		responseerror.RespondGenericServerErr(ctx, categoryErr, "error in creating category")
@@ -166,7 +189,10 @@ func (c *Controller) CreateBrand(ctx *gin.Context) {
 		return
 	}
 
-	err := c.adminService.CreateBrand(brandDetails.BrandName)
+	err := c.adminService.CreateBrand(&brandDetails)
+	if respondTaxonomyErr(ctx, err) {
+		return
+	}
 	if err != nil {
 		logrus.Errorf("CreateBrand: error in creating brand err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in creating brand")
@@ -177,8 +203,8 @@ func (c *Controller) CreateBrand(ctx *gin.Context) {
 }
 
 func (c *Controller) DeleteVariant(ctx *gin.Context) {
-	productID := ctx.Param("productID")
-	variantID := ctx.Param("variantID")
+	productID := ctx.Param("productId")
+	variantID := ctx.Param("variantId")
 	variantErr := c.adminService.DeleteVariant(productID, variantID)
 	if variantErr != nil {
 		logrus.Errorf("DeleteVariant: error in deleting variant err: %v", variantErr)
@@ -190,7 +216,7 @@ func (c *Controller) DeleteVariant(ctx *gin.Context) {
 }
 
 func (c *Controller) DeleteProduct(ctx *gin.Context) {
-	productID := ctx.Param("productID")
+	productID := ctx.Param("productId")
 	if err := c.adminService.DeleteProduct(productID); err != nil {
 		logrus.Errorf("DeleteProduct: error in deleting product err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in deleting product")
@@ -202,7 +228,12 @@ func (c *Controller) DeleteProduct(ctx *gin.Context) {
 
 func (c *Controller) DeleteCategory(ctx *gin.Context) {
 	categoryId := ctx.Param("categoryId")
-	if err := c.adminService.DeleteCategory(categoryId); err != nil {
+	err := c.adminService.DeleteCategory(categoryId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "category not found")
+		return
+	}
+	if err != nil {
 		logrus.Errorf("DeleteCategory: error in deleting category err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in deleting category")
 		return
@@ -222,6 +253,40 @@ func (c *Controller) DeleteBrand(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, "brand deleted successfully")
 }
 
+func (c *Controller) PublishProduct(ctx *gin.Context) {
+	err := c.adminService.PublishProduct(ctx.Param("productId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "product not found")
+		return
+	}
+	if errors.Is(err, models.ErrNotPublishable) {
+		responseerror.RespondClientErr(ctx, err, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("PublishProduct: error in publishing product err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in publishing product")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "product published successfully")
+}
+
+func (c *Controller) UnpublishProduct(ctx *gin.Context) {
+	err := c.adminService.UnpublishProduct(ctx.Param("productId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "product not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("UnpublishProduct: error in unpublishing product err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in unpublishing product")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "product unpublished successfully")
+}
+
 func (c *Controller) UpdateProduct(ctx *gin.Context) {
 	productID := ctx.Param("productId")
 	productDetails := models.Product{}
@@ -257,6 +322,69 @@ func (c *Controller) UpdateVariant(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, "variant updated successfully")
 }
 
+func (c *Controller) SetVariantSale(ctx *gin.Context) {
+	sale := models.VariantSaleBody{}
+	if parseErr := ctx.ShouldBind(&sale); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing sale details")
+		return
+	}
+
+	err := c.adminService.SetVariantSale(ctx.Param("productId"), ctx.Param("variantId"), &sale)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "variant not found")
+		return
+	}
+	if errors.Is(err, models.ErrInvalidSale) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("SetVariantSale: error in setting variant sale err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in setting variant sale")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "variant sale set successfully")
+}
+
+func (c *Controller) ClearVariantSale(ctx *gin.Context) {
+	err := c.adminService.ClearVariantSale(ctx.Param("productId"), ctx.Param("variantId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "variant not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("ClearVariantSale: error in removing variant sale err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in removing variant sale")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "variant sale removed successfully")
+}
+
+// BulkUpdateVariants adjusts the price and stock of many variants in one go, with preview
+// set nothing is saved and the response shows what would change.
+func (c *Controller) BulkUpdateVariants(ctx *gin.Context) {
+	details := models.BulkVariantUpdateBody{}
+	if parseErr := ctx.ShouldBind(&details); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing bulk update")
+		return
+	}
+
+	result, err := c.adminService.BulkUpdateVariants(&details)
+	if errors.Is(err, models.ErrInvalidBulkEdit) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("BulkUpdateVariants: error in updating variants err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating variants")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
 func (c *Controller) UpdateCategory(ctx *gin.Context) {
 	categoryID := ctx.Param("categoryId")
 	categoryDetails := models.Category{}
@@ -265,9 +393,14 @@ func (c *Controller) UpdateCategory(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.adminService.UpdateCategory(categoryID, categoryDetails.CategoryName); err != nil {
+	err := c.adminService.UpdateCategory(categoryID, &categoryDetails)
+	if respondTaxonomyErr(ctx, err) {
+		return
+	}
+	if err != nil {
 		logrus.Errorf("UpdateCategory: error in updating category err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in updating category")
+		return
 	}
 
 	ctx.JSON(http.StatusOK, "category updated successfully")
@@ -281,7 +414,12 @@ func (c *Controller) UpdateBrand(ctx *gin.Context) {
 		return
 	}
 
-	if err := c.adminService.UpdateBrand(brandID, brandDetails.BrandName); err != nil {
+	err := c.adminService.UpdateBrand(brandID, &brandDetails)
+	if respondTaxonomyErr(ctx, err) {
+		return
+	}
+	if err != nil {
+		logrus.Errorf("UpdateBrand: error in updating brand err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in updating brand")
 		return
 	}
@@ -290,10 +428,10 @@ func (c *Controller) UpdateBrand(ctx *gin.Context) {
 }
 
 func (c *Controller) GetAllUsers(ctx *gin.Context) {
-	limit, page, err := utils.GetLimitPage(ctx)
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest, pagination.SortName}, pagination.SortNewest)
 	if err != nil {
-		logrus.Errorf("GetAllUsers: error in parsing limit and page err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing limit and page")
+		logrus.Errorf("GetAllUsers: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
 		return
 	}
 
@@ -302,41 +440,40 @@ func (c *Controller) GetAllUsers(ctx *gin.Context) {
 	var usersCount int64
 
 	eg.Go(func() error {
-		users, err = c.adminService.GetAllUsers(limit, page)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		users, err = c.adminService.GetAllUsers(params)
+		return err
 	})
 
 	eg.Go(func() error {
+		var err error
 		usersCount, err = c.adminService.UsersCount()
-		if err != nil {
-			return err
-		}
-		return nil
+		return err
 	})
 
 	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		logrus.Errorf("GetAllUsers: error in getting users err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting users")
 		return
 	}
 
-	ctx.JSON(http.StatusOK, struct {
-		TotalRows int64
-		Rows      []models.Users
-	}{
-		TotalRows: usersCount,
-		Rows:      users,
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  usersCount,
+		Rows:       users,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
 	})
 }
 
 func (c *Controller) GetAllBrands(ctx *gin.Context) {
-	limit, page, err := utils.GetLimitPage(ctx)
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortName, pagination.SortNewest}, pagination.SortName)
 	if err != nil {
-		logrus.Errorf("GetAllBrands: error in parsing limit and page err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing limit and page")
+		logrus.Errorf("GetAllBrands: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
 		return
 	}
 
@@ -345,38 +482,40 @@ func (c *Controller) GetAllBrands(ctx *gin.Context) {
 	var brandsCount int64
 
 	eg.Go(func() error {
-		brands, err = c.adminService.GetAllBrands(limit, page)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		brands, err = c.adminService.GetAllBrands(params)
+		return err
 	})
 
 	eg.Go(func() error {
+		var err error
 		brandsCount, err = c.adminService.GetBrandsCount()
-		if err != nil {
-			return err
-		}
-		return nil
+		return err
 	})
 
 	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		logrus.Errorf("GetAllBrands: error in getting all brands err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting brands")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, models.Response{
-		TotalRows: brandsCount,
-		Rows:      brands,
+		TotalRows:  brandsCount,
+		Rows:       brands,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
 	})
 }
 
 func (c *Controller) GetAllCategory(ctx *gin.Context) {
-	limit, page, err := utils.GetLimitPage(ctx)
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortName, pagination.SortNewest}, pagination.SortName)
 	if err != nil {
-		logrus.Errorf("GetAllCategory: error in parsing limit and page err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing limit and page")
+		logrus.Errorf("GetAllCategory: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
 		return
 	}
 
@@ -385,30 +524,32 @@ func (c *Controller) GetAllCategory(ctx *gin.Context) {
 	var categoriesCount int64
 
 	eg.Go(func() error {
-		categories, err = c.adminService.GetAllCategory(limit, page)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		categories, err = c.adminService.GetAllCategory(params)
+		return err
 	})
 
 	eg.Go(func() error {
+		var err error
 		categoriesCount, err = c.adminService.GetCategoryCount()
-		if err != nil {
-			return err
-		}
-		return nil
+		return err
 	})
 
 	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		logrus.Errorf("GetAllCategory: error in getting all categories err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting categories")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, models.Response{
-		TotalRows: categoriesCount,
-		Rows:      categories,
+		TotalRows:  categoriesCount,
+		Rows:       categories,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
 	})
 }
 
@@ -423,3 +564,561 @@ func (c *Controller) ChangeUserRole(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, "user role changed")
 }
+
+func (c *Controller) CreateAttribute(ctx *gin.Context) {
+	categoryID := ctx.Param("categoryId")
+	attributeDetails := models.AttributeBody{}
+	if parseErr := ctx.ShouldBind(&attributeDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing attribute")
+		return
+	}
+
+	attributeID, err := c.adminService.CreateAttribute(categoryID, &attributeDetails)
+	if errors.Is(err, models.ErrInvalidAttribute) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrAttributeTaken) {
+		responseerror.RespondClientErr(ctx, err, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("CreateAttribute: error in creating attribute err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating attribute")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, attributeID)
+}
+
+func (c *Controller) GetCategoryAttributes(ctx *gin.Context) {
+	categoryID := ctx.Param("categoryId")
+	attributes, err := c.adminService.GetCategoryAttributes(categoryID)
+	if err != nil {
+		logrus.Errorf("GetCategoryAttributes: error in getting attributes err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting attributes")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, attributes)
+}
+
+func (c *Controller) DeleteAttribute(ctx *gin.Context) {
+	categoryID := ctx.Param("categoryId")
+	attributeID := ctx.Param("attributeId")
+	err := c.adminService.DeleteAttribute(categoryID, attributeID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "attribute not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("DeleteAttribute: error in deleting attribute err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in deleting attribute")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "attribute deleted successfully")
+}
+
+func (c *Controller) SetProductAttributes(ctx *gin.Context) {
+	productID := ctx.Param("productId")
+	attributes := models.ProductAttributes{}
+	if parseErr := ctx.ShouldBindJSON(&attributes); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing product attributes")
+		return
+	}
+
+	err := c.adminService.SetProductAttributes(productID, attributes)
+	if errors.Is(err, models.ErrInvalidAttribute) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("SetProductAttributes: error in updating product attributes err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating product attributes")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "product attributes updated successfully")
+}
+
+func (c *Controller) GetCategoryTree(ctx *gin.Context) {
+	tree, err := c.adminService.GetCategoryTree()
+	if err != nil {
+		logrus.Errorf("GetCategoryTree: error in getting category tree err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting categories")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tree)
+}
+
+// GetReviews lists the reviews waiting for moderation, or those in the status asked for.
+func (c *Controller) GetReviews(ctx *gin.Context) {
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest, pagination.SortRating}, pagination.SortNewest)
+	if err != nil {
+		logrus.Errorf("GetReviews: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
+
+	status := models.ReviewStatus(ctx.DefaultQuery("status", string(models.ReviewPending)))
+	if status != models.ReviewPending && status != models.ReviewApproved && status != models.ReviewHidden {
+		responseerror.RespondClientErr(ctx, errors.New("invalid review status"), http.StatusBadRequest, "invalid review status")
+		return
+	}
+
+	eg := &errgroup.Group{}
+	var reviews []models.ProductReview
+	var reviewsCount int64
+
+	eg.Go(func() error {
+		var err error
+		reviews, err = c.reviewService.GetReviewsByStatus(status, params)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		reviewsCount, err = c.reviewService.CountReviewsByStatus(status)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetReviews: error in getting reviews err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting reviews")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  reviewsCount,
+		Rows:       reviews,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
+	})
+}
+
+func (c *Controller) ModerateReview(ctx *gin.Context) {
+	body := models.ModerationBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing review status")
+		return
+	}
+
+	err := c.reviewService.ModerateReview(ctx.Param("reviewId"), body.Status)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "review not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("ModerateReview: error in moderating review err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in moderating review")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "review status updated")
+}
+
+// GetQuestions lists the questions of all products, hidden ones included, unanswered=true
+// leaves out those that already have a visible answer.
+func (c *Controller) GetQuestions(ctx *gin.Context) {
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest}, pagination.SortNewest)
+	if err != nil {
+		logrus.Errorf("GetQuestions: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
+
+	unanswered := ctx.Query("unanswered") == "true"
+	eg := &errgroup.Group{}
+	var questions []models.ProductQuestion
+	var questionsCount int64
+
+	eg.Go(func() error {
+		var err error
+		questions, err = c.questionService.GetQuestions(unanswered, params)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		questionsCount, err = c.questionService.CountQuestions(unanswered)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetQuestions: error in getting questions err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting questions")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  questionsCount,
+		Rows:       questions,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
+	})
+}
+
+func (c *Controller) AnswerQuestion(ctx *gin.Context) {
+	body := models.AnswerBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing answer")
+		return
+	}
+
+	adminID := ctx.Value("userID").(string)
+	answerID, err := c.questionService.AnswerQuestion(adminID, ctx.Param("questionId"), &body, true)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "question not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AnswerQuestion: error in creating answer err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating answer")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, answerID)
+}
+
+func (c *Controller) SetQuestionVisibility(ctx *gin.Context) {
+	body := models.VisibilityBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing visibility")
+		return
+	}
+
+	err := c.questionService.SetQuestionHidden(ctx.Param("questionId"), *body.Hidden)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "question not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("SetQuestionVisibility: error in updating question err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating question")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "question updated successfully")
+}
+
+func (c *Controller) SetAnswerVisibility(ctx *gin.Context) {
+	body := models.VisibilityBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing visibility")
+		return
+	}
+
+	err := c.questionService.SetAnswerHidden(ctx.Param("answerId"), *body.Hidden)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "answer not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("SetAnswerVisibility: error in updating answer err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating answer")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "answer updated successfully")
+}
+
+func (c *Controller) GetVariantGallery(ctx *gin.Context) {
+	gallery, err := c.adminService.GetVariantGallery(ctx.Param("productId"), ctx.Param("variantId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "variant not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("GetVariantGallery: error in getting gallery err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting gallery")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gallery)
+}
+
+func (c *Controller) AddVariantImages(ctx *gin.Context) {
+	body := models.GalleryImageIdsBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing images")
+		return
+	}
+
+	err := c.adminService.AddGalleryImages(ctx.Param("productId"), ctx.Param("variantId"), body.ImageIds)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "variant or image not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AddVariantImages: error in adding images err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in adding images")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, "images added successfully")
+}
+
+func (c *Controller) ReorderGallery(ctx *gin.Context) {
+	body := models.GalleryImageIdsBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing gallery order")
+		return
+	}
+
+	err := c.adminService.ReorderGallery(ctx.Param("productId"), ctx.Param("variantId"), body.ImageIds)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "variant not found")
+		return
+	}
+	if errors.Is(err, models.ErrInvalidGallery) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("ReorderGallery: error in reordering gallery err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in reordering gallery")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "gallery reordered successfully")
+}
+
+func (c *Controller) UpdateGalleryImage(ctx *gin.Context) {
+	body := models.GalleryImageBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing gallery image")
+		return
+	}
+
+	err := c.adminService.UpdateGalleryImage(ctx.Param("productId"), ctx.Param("variantId"), ctx.Param("imageId"), &body)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "image not found in gallery")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("UpdateGalleryImage: error in updating gallery image err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating gallery image")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "gallery image updated successfully")
+}
+
+func (c *Controller) DetachImage(ctx *gin.Context) {
+	err := c.adminService.DetachImage(ctx.Param("productId"), ctx.Param("variantId"), ctx.Param("imageId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "image not found in gallery")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("DetachImage: error in detaching image err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in detaching image")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "image detached successfully")
+}
+
+func (c *Controller) DeleteImage(ctx *gin.Context) {
+	err := c.adminService.DeleteImage(ctx.Request.Context(), ctx.Param("imageId"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "image not found")
+		return
+	}
+	if errors.Is(err, models.ErrImageInUse) {
+		responseerror.RespondClientErr(ctx, err, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("DeleteImage: error in deleting image err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in deleting image")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "image deleted successfully")
+}
+
+// GetOrphanImages lists the uploaded images attached to no variant or review, the cleanup
+// job deletes them once they are a day old.
+func (c *Controller) GetOrphanImages(ctx *gin.Context) {
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest}, pagination.SortNewest)
+	if err != nil {
+		logrus.Errorf("GetOrphanImages: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
+
+	eg := &errgroup.Group{}
+	var images []models.OrphanImage
+	var imagesCount int64
+
+	eg.Go(func() error {
+		var err error
+		images, err = c.adminService.GetOrphanImages(params)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		imagesCount, err = c.adminService.CountOrphanImages()
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetOrphanImages: error in getting orphan images err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting images")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  imagesCount,
+		Rows:       images,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
+	})
+}
+
+// CleanupOrphanImages runs the orphan image cleanup right away instead of waiting for the
+// scheduled run.
+func (c *Controller) CleanupOrphanImages(ctx *gin.Context) {
+	deleted, err := c.adminService.CleanupOrphanImages(ctx.Request.Context())
+	if err != nil {
+		logrus.Errorf("CleanupOrphanImages: error in cleaning up images err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in cleaning up images")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+// ImportProducts queues importing the csv or json lines file in the file field, the format
+// is taken from the format query or the file extension. dryRun=true only validates it.
+func (c *Controller) ImportProducts(ctx *gin.Context) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, catalogfile.MaxFileSize+1<<20)
+	file, header, err := ctx.Request.FormFile("file")
+	if err != nil {
+		logrus.Errorf("ImportProducts: error in parsing multipart form err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing file")
+		return
+	}
+	defer file.Close()
+
+	format, err := catalogfile.ParseFormat(ctx.Query("format"), header.Filename)
+	if err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, catalogfile.MaxFileSize+1))
+	if err != nil {
+		logrus.Errorf("ImportProducts: error in reading file err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in reading file")
+		return
+	}
+	if len(data) > catalogfile.MaxFileSize {
+		responseerror.RespondClientErr(ctx, errors.New("file is too large"), http.StatusRequestEntityTooLarge, "file is too large")
+		return
+	}
+
+	adminID := ctx.Value("userID").(string)
+	job, err := c.adminService.CreateCatalogImport(adminID, format, ctx.Query("dryRun") == "true", data)
+	if err != nil {
+		logrus.Errorf("ImportProducts: error in creating import err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating import")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// ExportProducts queues exporting the catalog as csv, or json lines with format=jsonl.
+func (c *Controller) ExportProducts(ctx *gin.Context) {
+	format, err := catalogfile.ParseFormat(ctx.DefaultQuery("format", string(models.CatalogCSV)), "")
+	if err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	adminID := ctx.Value("userID").(string)
+	job, err := c.adminService.CreateCatalogExport(adminID, format)
+	if err != nil {
+		logrus.Errorf("ExportProducts: error in creating export err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating export")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+func (c *Controller) GetCatalogJob(ctx *gin.Context) {
+	job, err := c.adminService.GetCatalogJob(ctx.Param("jobId"), false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "catalog job not found")
+			return
+		}
+		logrus.Errorf("GetCatalogJob: error in getting catalog job err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting catalog job")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+func (c *Controller) DownloadCatalogExport(ctx *gin.Context) {
+	job, err := c.adminService.GetCatalogJob(ctx.Param("jobId"), true)
+	if err == nil && job.Kind != models.CatalogExport {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "catalog export not found")
+			return
+		}
+		logrus.Errorf("DownloadCatalogExport: error in getting catalog job err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting catalog export")
+		return
+	}
+
+	if job.Status != models.ExportCompleted {
+		responseerror.RespondClientErr(ctx, errors.New("export not ready"), http.StatusConflict, "catalog export is not completed yet")
+		return
+	}
+
+	if job.ExpiresAt.Before(time.Now()) {
+		responseerror.RespondClientErr(ctx, errors.New("export expired"), http.StatusGone, "catalog export has expired, request a new one")
+		return
+	}
+
+	contentType := catalogfile.ContentType(job.Format)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"audiophile-catalog-%s.%s\"", job.CreatedAt.Format("2006-01-02"), job.Format))
+	ctx.Data(http.StatusOK, contentType, job.Output)
+}
+
+// respondTaxonomyErr answers the client errors of creating or updating categories and
+// brands, it reports whether a response was written.
+func respondTaxonomyErr(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrSlugTaken):
+		responseerror.RespondClientErr(ctx, err, http.StatusConflict, "slug is already in use")
+	case errors.Is(err, models.ErrInvalidParent):
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid parent category")
+	default:
+		return false
+	}
+	return true
+}
@@ -2,22 +2,43 @@ package public
 
 import (
 	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/internal/oidc"
+	"github.com/Shresth92/audiophile/internal/token"
 	"github.com/Shresth92/audiophile/models"
 	"github.com/Shresth92/audiophile/responseerror"
 	"github.com/Shresth92/audiophile/services"
 	"github.com/Shresth92/audiophile/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Controller struct {
 	publicService services.PublicService
+	mailer        internal.Mailer
+	oidcProviders oidc.Providers
+	tokenManager  *token.Manager
 }
 
-func NewController(publicService services.PublicService) *Controller {
-	return &Controller{publicService: publicService}
+func NewController(
+	publicService services.PublicService,
+	mailer internal.Mailer,
+	oidcProviders oidc.Providers,
+	tokenManager *token.Manager,
+) *Controller {
+	return &Controller{
+		publicService: publicService,
+		mailer:        mailer,
+		oidcProviders: oidcProviders,
+		tokenManager:  tokenManager,
+	}
 }
 
 func (c *Controller) Register(ctx *gin.Context) {
@@ -81,16 +102,46 @@ func (c *Controller) Login(ctx *gin.Context) {
 		role = models.User
 	}
 
+	lockedUntil, lockedErr := c.publicService.LoginLockedUntil(userDetails.Email, ctx.ClientIP())
+	if lockedErr != nil {
+		logrus.Errorf("Login: error in checking login attempts err = %v", lockedErr)
+		responseerror.RespondGenericServerErr(ctx, lockedErr, "error in checking login attempts")
+		return
+	}
+
+	if retryAfter := time.Until(lockedUntil); retryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		responseerror.RespondClientErr(ctx, errors.New("too many login attempts"), http.StatusTooManyRequests, "too many failed login attempts, try again later")
+		return
+	}
+
 	user, userErr := c.publicService.GetUserDetails(userDetails.Email)
-	if userErr != nil {
+	if userErr != nil && !errors.Is(userErr, gorm.ErrRecordNotFound) {
 		logrus.Errorf("Login: error in getting user credentials err = %v", userErr)
 		responseerror.RespondGenericServerErr(ctx, userErr, "error in getting user details")
 		return
 	}
 
-	isPasswordMatched := utils.CheckPassword(userDetails.Password, user.Password)
-	if !isPasswordMatched {
-		responseerror.RespondGenericServerErr(ctx, userErr, "incorrect password")
+	// unknown emails are compared against a dummy hash so they take as long as wrong passwords
+	passwordHash := user.Password
+	if userErr != nil {
+		passwordHash = utils.DummyPasswordHash
+	}
+	if !utils.CheckPassword(userDetails.Password, passwordHash) || userErr != nil {
+		if failureErr := c.publicService.RecordLoginFailure(userDetails.Email, ctx.ClientIP()); failureErr != nil {
+			logrus.Errorf("Login: error in recording failed login err = %v", failureErr)
+		}
+		responseerror.RespondClientErr(ctx, errors.New("invalid credentials"), http.StatusUnauthorized, "incorrect email or password")
+		return
+	}
+
+	if resetErr := c.publicService.ResetLoginFailures(userDetails.Email); resetErr != nil {
+		logrus.Errorf("Login: error in resetting failed logins err = %v", resetErr)
+	}
+
+	// admins never get a token for the password alone, they continue with the two factor step
+	if role == models.Admin {
+		c.startAdminChallenge(ctx, user.Id)
 		return
 	}
 
@@ -101,7 +152,7 @@ func (c *Controller) Login(ctx *gin.Context) {
 		return
 	}
 
-	token, tokenErr := utils.GenerateJWTToken(user.Id, sessionId, role)
+	token, tokenErr := c.tokenManager.Generate(user.Id, sessionId, role)
 	if tokenErr != nil {
 		logrus.Errorf("Login: error in generating jwt token err = %v", tokenErr)
 		responseerror.RespondGenericServerErr(ctx, tokenErr, "error in generating jwt token")
@@ -123,3 +174,430 @@ func (c *Controller) Logout(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusCreated, "You are logged out")
 }
+
+func (c *Controller) ForgotPassword(ctx *gin.Context) {
+	forgotPasswordDetails := models.ForgotPasswordBody{}
+	if parseErr := ctx.ShouldBind(&forgotPasswordDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing email")
+		return
+	}
+
+	// the response is the same whether the account exists or not so this
+	// endpoint can't be used to find out which emails are registered
+	const response = "if the account exists a password reset mail has been sent"
+
+	user, userErr := c.publicService.GetUserDetails(forgotPasswordDetails.Email)
+	if userErr != nil {
+		if errors.Is(userErr, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusOK, response)
+			return
+		}
+		logrus.Errorf("ForgotPassword: error in getting user details err = %v", userErr)
+		responseerror.RespondGenericServerErr(ctx, userErr, "error in getting user details")
+		return
+	}
+
+	// failures past this point only happen for existing accounts, they are logged but
+	// answered like any other request
+	token, tokenErr := c.publicService.CreatePasswordResetToken(user.Id)
+	if tokenErr != nil {
+		logrus.Errorf("ForgotPassword: error in creating reset token err = %v", tokenErr)
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	body := fmt.Sprintf("Use the link below to reset your password, it is valid for 30 minutes.\n\n%s%s", utils.GetEnvValue("passwordResetUrl"), token)
+	if mailErr := c.mailer.Send(user.Email, "Reset your password", body); mailErr != nil {
+		logrus.Errorf("ForgotPassword: error in sending reset mail err = %v", mailErr)
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (c *Controller) ResetPassword(ctx *gin.Context) {
+	resetPasswordDetails := models.ResetPasswordBody{}
+	if parseErr := ctx.ShouldBind(&resetPasswordDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing reset details")
+		return
+	}
+
+	// the token is checked before hashing so invalid requests never cost a bcrypt round
+	if tokenErr := c.publicService.CheckPasswordResetToken(resetPasswordDetails.Token); tokenErr != nil {
+		if errors.Is(tokenErr, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, tokenErr, http.StatusBadRequest, "reset token is invalid or expired")
+			return
+		}
+		logrus.Errorf("ResetPassword: error in checking reset token err = %v", tokenErr)
+		responseerror.RespondGenericServerErr(ctx, tokenErr, "error in checking reset token")
+		return
+	}
+
+	hashedPassword, hashedPasswordErr := utils.HashPassword(resetPasswordDetails.Password)
+	if hashedPasswordErr != nil {
+		logrus.Errorf("ResetPassword: error in password hashing err = %v", hashedPasswordErr)
+		responseerror.RespondGenericServerErr(ctx, errors.New("error in password hashing"), "error in password hashing")
+		return
+	}
+
+	err := c.publicService.ResetPassword(resetPasswordDetails.Token, hashedPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "reset token is invalid or expired")
+			return
+		}
+		logrus.Errorf("ResetPassword: error in resetting password err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in resetting password")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "password reset successfully")
+}
+
+func (c *Controller) OidcLogin(ctx *gin.Context) {
+	providerName := ctx.Param("provider")
+	provider, ok := c.oidcProviders[providerName]
+	if !ok {
+		responseerror.RespondClientErr(ctx, errors.New("unknown provider"), http.StatusNotFound, "login provider not found")
+		return
+	}
+
+	loginState, err := c.publicService.CreateOidcLoginState(providerName)
+	if err != nil {
+		logrus.Errorf("OidcLogin: error in creating login state err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating login state")
+		return
+	}
+
+	redirectUrl, err := provider.AuthCodeURL(ctx.Request.Context(), loginState.State, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		logrus.Errorf("OidcLogin: error in building authorization url err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in contacting login provider")
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, redirectUrl)
+}
+
+func (c *Controller) OidcCallback(ctx *gin.Context) {
+	providerName := ctx.Param("provider")
+	provider, ok := c.oidcProviders[providerName]
+	if !ok {
+		responseerror.RespondClientErr(ctx, errors.New("unknown provider"), http.StatusNotFound, "login provider not found")
+		return
+	}
+
+	if providerErr := ctx.Query("error"); providerErr != "" {
+		responseerror.RespondClientErr(ctx, errors.New(providerErr), http.StatusUnauthorized, "login was not completed", ctx.Query("error_description"))
+		return
+	}
+
+	loginState, err := c.publicService.ConsumeOidcLoginState(ctx.Query("state"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "login state is invalid or expired")
+			return
+		}
+		logrus.Errorf("OidcCallback: error in getting login state err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting login state")
+		return
+	}
+
+	if loginState.Provider != providerName {
+		responseerror.RespondClientErr(ctx, errors.New("provider mismatch"), http.StatusBadRequest, "login state is invalid or expired")
+		return
+	}
+
+	identity, err := provider.Exchange(ctx.Request.Context(), ctx.Query("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "error in verifying login with provider")
+		return
+	}
+
+	userId, err := c.publicService.LinkOidcIdentity(providerName, identity.Subject, identity.Email, identity.EmailVerified)
+	if err != nil {
+		if errors.Is(err, models.ErrIdentityConflict) {
+			responseerror.RespondClientErr(ctx, err, http.StatusConflict, "an account with this email already exists, log in with your password")
+			return
+		}
+		logrus.Errorf("OidcCallback: error in linking identity err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in linking identity")
+		return
+	}
+
+	sessionId, sessionErr := c.publicService.GetSessionId(userId)
+	if sessionErr != nil {
+		logrus.Errorf("OidcCallback: error in creating session err = %v", sessionErr)
+		responseerror.RespondGenericServerErr(ctx, sessionErr, "error in creating session")
+		return
+	}
+
+	token, tokenErr := c.tokenManager.Generate(userId, sessionId, models.User)
+	if tokenErr != nil {
+		logrus.Errorf("OidcCallback: error in generating jwt token err = %v", tokenErr)
+		responseerror.RespondGenericServerErr(ctx, tokenErr, "error in generating jwt token")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, token)
+}
+
+func (c *Controller) startAdminChallenge(ctx *gin.Context, userId string) {
+	isAdmin, err := c.publicService.HasRole(userId, models.Admin)
+	if err != nil {
+		logrus.Errorf("Login: error in getting user roles err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting user roles")
+		return
+	}
+
+	if !isAdmin {
+		responseerror.RespondClientErr(ctx, errors.New("not admin"), http.StatusUnauthorized, "not admin")
+		return
+	}
+
+	next := "enroll"
+	totp, err := c.publicService.GetUserTotp(userId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logrus.Errorf("Login: error in getting two factor details err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting two factor details")
+		return
+	}
+	if err == nil && !totp.EnabledAt.IsZero() {
+		next = "totp"
+	}
+
+	challengeToken, expiresAt, err := c.publicService.CreateLoginChallenge(userId, models.Admin)
+	if err != nil {
+		logrus.Errorf("Login: error in creating login challenge err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating login challenge")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, models.LoginChallengeResponse{
+		ChallengeToken: challengeToken,
+		Next:           next,
+		ExpiresAt:      expiresAt,
+	})
+}
+
+func (c *Controller) getLoginChallenge(ctx *gin.Context, twoFactorDetails *models.TwoFactorBody) (models.LoginChallenge, bool) {
+	if parseErr := ctx.ShouldBind(twoFactorDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing two factor details")
+		return models.LoginChallenge{}, false
+	}
+
+	challenge, err := c.publicService.GetLoginChallenge(twoFactorDetails.ChallengeToken)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "login challenge is invalid or expired, log in again")
+			return challenge, false
+		}
+		logrus.Errorf("getLoginChallenge: error in getting login challenge err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting login challenge")
+		return challenge, false
+	}
+	return challenge, true
+}
+
+func (c *Controller) EnrollTotp(ctx *gin.Context) {
+	twoFactorDetails := models.TwoFactorBody{}
+	challenge, ok := c.getLoginChallenge(ctx, &twoFactorDetails)
+	if !ok {
+		return
+	}
+
+	totp, err := c.publicService.GetUserTotp(challenge.UserId)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logrus.Errorf("EnrollTotp: error in getting two factor details err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting two factor details")
+		return
+	}
+	if err == nil && !totp.EnabledAt.IsZero() {
+		responseerror.RespondClientErr(ctx, errors.New("already enrolled"), http.StatusConflict, "two factor authentication is already enabled")
+		return
+	}
+
+	user, err := c.publicService.GetUserById(challenge.UserId)
+	if err != nil {
+		logrus.Errorf("EnrollTotp: error in getting user details err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting user details")
+		return
+	}
+
+	secret, err := c.publicService.StartTotpEnrollment(challenge.UserId)
+	if err != nil {
+		logrus.Errorf("EnrollTotp: error in starting enrollment err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in starting two factor enrollment")
+		return
+	}
+
+	issuer := utils.GetEnvValue("totpIssuer")
+	if issuer == "" {
+		issuer = "Audiophile"
+	}
+
+	ctx.JSON(http.StatusCreated, models.TotpEnrollment{
+		Secret:     secret,
+		OtpauthUrl: utils.TotpUrl(issuer, user.Email, secret),
+	})
+}
+
+func (c *Controller) VerifyTwoFactor(ctx *gin.Context) {
+	twoFactorDetails := models.TwoFactorBody{}
+	challenge, ok := c.getLoginChallenge(ctx, &twoFactorDetails)
+	if !ok {
+		return
+	}
+
+	lockedUntil, err := c.publicService.TwoFactorLockedUntil(challenge.UserId)
+	if err != nil {
+		logrus.Errorf("VerifyTwoFactor: error in checking two factor attempts err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in checking two factor attempts")
+		return
+	}
+	if retryAfter := time.Until(lockedUntil); retryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		responseerror.RespondClientErr(ctx, errors.New("too many two factor attempts"), http.StatusTooManyRequests, "too many invalid two factor codes, try again later")
+		return
+	}
+
+	if err := c.publicService.UseLoginChallengeAttempt(challenge.Id); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "login challenge is invalid or expired, log in again")
+			return
+		}
+		logrus.Errorf("VerifyTwoFactor: error in counting two factor attempt err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in counting two factor attempt")
+		return
+	}
+
+	totp, err := c.publicService.GetUserTotp(challenge.UserId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "two factor authentication is not enrolled")
+			return
+		}
+		logrus.Errorf("VerifyTwoFactor: error in getting two factor details err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting two factor details")
+		return
+	}
+
+	isEnrolled := !totp.EnabledAt.IsZero()
+	if twoFactorDetails.RecoveryCode != "" && isEnrolled {
+		err = c.publicService.UseRecoveryCode(challenge.UserId, twoFactorDetails.RecoveryCode)
+	} else {
+		err = c.publicService.VerifyTotpCode(challenge.UserId, twoFactorDetails.Code)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidTotpCode) {
+			if failureErr := c.publicService.RecordTwoFactorFailure(challenge.UserId); failureErr != nil {
+				logrus.Errorf("VerifyTwoFactor: error in recording failed attempt err = %v", failureErr)
+			}
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "invalid two factor code")
+			return
+		}
+		logrus.Errorf("VerifyTwoFactor: error in verifying two factor code err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in verifying two factor code")
+		return
+	}
+
+	if resetErr := c.publicService.ResetTwoFactorFailures(challenge.UserId); resetErr != nil {
+		logrus.Errorf("VerifyTwoFactor: error in resetting failed attempts err = %v", resetErr)
+	}
+
+	if err := c.publicService.CompleteLoginChallenge(challenge.Id); err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "login challenge is invalid or expired, log in again")
+			return
+		}
+		logrus.Errorf("VerifyTwoFactor: error in completing login challenge err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in completing login challenge")
+		return
+	}
+
+	var recoveryCodes []string
+	if !isEnrolled {
+		recoveryCodes, err = c.publicService.EnableTotp(challenge.UserId)
+		if err != nil {
+			logrus.Errorf("VerifyTwoFactor: error in enabling two factor authentication err = %v", err)
+			responseerror.RespondGenericServerErr(ctx, err, "error in enabling two factor authentication")
+			return
+		}
+	}
+
+	sessionId, sessionErr := c.publicService.GetSessionId(challenge.UserId)
+	if sessionErr != nil {
+		logrus.Errorf("VerifyTwoFactor: error in creating session err = %v", sessionErr)
+		responseerror.RespondGenericServerErr(ctx, sessionErr, "error in creating session")
+		return
+	}
+
+	token, tokenErr := c.tokenManager.Generate(challenge.UserId, sessionId, challenge.Role)
+	if tokenErr != nil {
+		logrus.Errorf("VerifyTwoFactor: error in generating jwt token err = %v", tokenErr)
+		responseerror.RespondGenericServerErr(ctx, tokenErr, "error in generating jwt token")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, models.TwoFactorLogin{
+		Token:         token,
+		RecoveryCodes: recoveryCodes,
+	})
+}
+
+func (c *Controller) RegenerateRecoveryCodes(ctx *gin.Context) {
+	codeDetails := models.TotpCodeBody{}
+	if parseErr := ctx.ShouldBind(&codeDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing two factor code")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	if err := c.publicService.VerifyTotpCode(userID, codeDetails.Code); err != nil {
+		if errors.Is(err, models.ErrInvalidTotpCode) || errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "invalid two factor code")
+			return
+		}
+		logrus.Errorf("RegenerateRecoveryCodes: error in verifying two factor code err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in verifying two factor code")
+		return
+	}
+
+	recoveryCodes, err := c.publicService.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		logrus.Errorf("RegenerateRecoveryCodes: error in generating recovery codes err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in generating recovery codes")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, recoveryCodes)
+}
+
+func (c *Controller) Jwks(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, c.tokenManager.JWKS())
+}
+
+func (c *Controller) VerifyEmail(ctx *gin.Context) {
+	verifyDetails := models.VerifyEmailBody{}
+	if parseErr := ctx.ShouldBind(&verifyDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing verification details")
+		return
+	}
+
+	err := c.publicService.ConfirmEmailChange(verifyDetails.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidToken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "verification token is invalid or expired")
+			return
+		}
+		if errors.Is(err, models.ErrEmailTaken) {
+			responseerror.RespondClientErr(ctx, err, http.StatusConflict, "email is already in use")
+			return
+		}
+		logrus.Errorf("VerifyEmail: error in changing email err = %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in changing email")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "email changed successfully")
+}
@@ -1,9 +1,13 @@
 package user
 
 import (
-	cloud "cloud.google.com/go/storage"
 	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/internal/imaging"
+	"github.com/Shresth92/audiophile/internal/storage"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
 	"github.com/Shresth92/audiophile/responseerror"
 	"github.com/Shresth92/audiophile/services"
 	"github.com/Shresth92/audiophile/utils"
@@ -11,23 +15,57 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	attributeFilterPrefix = "attr."
+	maxComparedProducts   = 4
+	// productQuestionsLimit is how many questions GetProduct includes, the rest are paged
+	// through GetProductQuestions
+	productQuestionsLimit = 5
+)
+
 type Controller struct {
-	userService services.UserServices
+	userService     services.UserServices
+	searchService   services.SearchServices
+	reviewService   services.ReviewServices
+	questionService services.QuestionServices
+	imageURLs       *storage.ImageURLService
+	mailer          internal.Mailer
 }
 
-func NewController(userService services.UserServices) *Controller {
-	return &Controller{userService: userService}
+func NewController(
+	userService services.UserServices,
+	searchService services.SearchServices,
+	reviewService services.ReviewServices,
+	questionService services.QuestionServices,
+	imageURLs *storage.ImageURLService,
+	mailer internal.Mailer) *Controller {
+	return &Controller{
+		userService:     userService,
+		searchService:   searchService,
+		reviewService:   reviewService,
+		questionService: questionService,
+		imageURLs:       imageURLs,
+		mailer:          mailer,
+	}
 }
 
 func (c *Controller) AddProductToCart(ctx *gin.Context) {
 	variantId := ctx.Param("variantId")
 	userID := ctx.Value("userID").(string)
 	err := c.userService.AddProductToCart(userID, variantId)
+	if errors.Is(err, models.ErrVariantNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, err.Error())
+		return
+	}
 	if err != nil {
 		logrus.Errorf("AddProductToCart: error in adding product to cart err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in adding product to cart")
@@ -95,166 +133,346 @@ func (c *Controller) GetMyCart(ctx *gin.Context) {
 }
 
 func (c *Controller) GetAllProducts(ctx *gin.Context) {
-	limit, page, err := utils.GetLimitPage(ctx)
-	if err != nil {
-		logrus.Errorf("GetAllProducts: error in parsing limit and page err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing limit and page")
+	params := &models.ProductSearchParams{}
+	if parseErr := ctx.ShouldBindQuery(params); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing product filters")
 		return
 	}
+	attributeFilters, parseErr := parseAttributeFilters(ctx.Request.URL.Query())
+	if parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing attribute filters")
+		return
+	}
+	params.Attributes = attributeFilters
+	if ctx.Value("role") != models.Admin {
+		params.Status = models.ProductPublished
+	}
 
-	searchString := ctx.Query("searchString")
-	categoryFilter := ctx.Query("categoryFilter")
-	brandFilter := ctx.Query("brandFilter")
+	sortKeys := []pagination.SortKey{pagination.SortPrice, pagination.SortNewest, pagination.SortName, pagination.SortPopularity}
+	defaultSort := pagination.SortName
+	if params.SearchString != "" {
+		sortKeys = append(sortKeys, pagination.SortRelevance)
+		defaultSort = pagination.SortRelevance
+	}
+	page, err := pagination.FromQuery(ctx, sortKeys, defaultSort)
+	if err != nil {
+		logrus.Errorf("GetAllProducts: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
 
 	eg := &errgroup.Group{}
 	var count int64
 	var products []models.AllProducts
+	var facets models.ProductFacets
 
 	eg.Go(func() error {
-		count, err = c.userService.FilterAllProductsCount(searchString, categoryFilter, brandFilter)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		count, err = c.searchService.CountProducts(params)
+		return err
 	})
 
 	eg.Go(func() error {
-		products, err = c.userService.FilterAllProducts(limit, page, searchString, categoryFilter, brandFilter)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		products, err = c.searchService.SearchProducts(params, page)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		facets, err = c.searchService.ProductFacets(params)
+		return err
 	})
 
 	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		logrus.Errorf("GetAllProducts: error in getting products: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting products")
 		return
 	}
 
-	productMap := make(map[string]models.Products)
-	client := models.FirebaseClient
-	for _, product := range products {
-		_, ok := productMap[product.VariantID]
-
-		signedUrl := &cloud.SignedURLOptions{
-			Scheme:  cloud.SigningSchemeV4,
-			Method:  "GET",
-			Expires: time.Now().Add(15 * time.Minute),
-		}
-		url, err := client.Storage.Bucket(product.BucketName).SignedURL(product.Path, signedUrl)
-		if err != nil {
-			logrus.Errorf("GetAllProducts: error in generating image url: %v", err)
-			responseerror.RespondGenericServerErr(ctx, err, "error in generating image")
-			return
-		}
-
-		var newProduct models.Products
-		if !ok {
-			newProduct = models.Products{
-				Id:           product.VariantID,
-				ProductName:  product.ProductName,
-				ModelName:    product.ModelName,
-				BrandName:    product.BrandName,
-				CategoryName: product.CategoryName,
-				Return:       product.Return,
-				Warranty:     product.Warranty,
-				Wireless:     product.Wireless,
-				Colour:       product.Colour,
-				Price:        product.Price,
-				Stock:        product.Stock,
-				ImageLinks:   []string{url},
-			}
-		} else {
-			newProduct = models.Products{
-				Id:           product.VariantID,
-				ProductName:  product.ProductName,
-				ModelName:    product.ModelName,
-				BrandName:    product.BrandName,
-				CategoryName: product.CategoryName,
-				Return:       product.Return,
-				Warranty:     product.Warranty,
-				Wireless:     product.Wireless,
-				Colour:       product.Colour,
-				Price:        product.Price,
-				Stock:        product.Stock,
-				ImageLinks:   append(productMap[product.VariantID].ImageLinks, url),
-			}
-		}
-		productMap[product.VariantID] = newProduct
+	catalog, err := c.catalogProducts(products)
+	if err != nil {
+		logrus.Errorf("GetAllProducts: error in getting image renditions: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting images")
+		return
+	}
+	if err := c.addCatalogDetails(catalog); err != nil {
+		logrus.Errorf("GetAllProducts: error in getting breadcrumbs and ratings: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting products")
+		return
 	}
 
-	ctx.JSON(http.StatusOK, models.Response{
-		TotalRows: count,
-		Rows:      productMap,
+	ctx.JSON(http.StatusOK, models.ProductSearchResponse{
+		Response: models.Response{
+			TotalRows:  count,
+			Rows:       catalog,
+			NextCursor: page.Next,
+			PrevCursor: page.Prev,
+		},
+		Facets: facets,
 	})
 }
 
 func (c *Controller) GetProduct(ctx *gin.Context) {
 	productID := ctx.Param("productId")
-	products, err := c.userService.GetProduct(productID)
+	products, err := c.userService.GetProduct(productID, ctx.Value("role") == models.Admin)
 	if err != nil {
 		logrus.Errorf("GetProduct: error in getting product err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting product")
 		return
 	}
 
-	productMap := make(map[string]models.Products)
-	client := models.FirebaseClient
-	for _, product := range products {
-		_, ok := productMap[product.VariantID]
+	catalog, err := c.catalogProducts(products)
+	if err != nil {
+		logrus.Errorf("GetProduct: error in getting image renditions err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting images")
+		return
+	}
+	if len(catalog) == 0 {
+		responseerror.RespondClientErr(ctx, errors.New("product not found"), http.StatusNotFound, "product not found")
+		return
+	}
+
+	if err := c.addCatalogDetails(catalog); err != nil {
+		logrus.Errorf("GetProduct: error in getting breadcrumbs and ratings err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting product")
+		return
+	}
+
+	product := catalog[0]
+	questionsPage := &pagination.Params{Limit: productQuestionsLimit, Page: 1, Sort: pagination.SortNewest, Desc: true}
+	var questions []models.ProductQuestion
+	var questionsCount int64
+	eg := &errgroup.Group{}
+
+	eg.Go(func() error {
+		var err error
+		product.Attributes, err = c.userService.GetProductAttributes(productID)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		questions, err = c.questionService.GetProductQuestions(productID, questionsPage)
+		return err
+	})
 
-		signedUrl := &cloud.SignedURLOptions{
-			Scheme:  cloud.SigningSchemeV4,
-			Method:  "GET",
-			Expires: time.Now().Add(15 * time.Minute),
+	eg.Go(func() error {
+		var err error
+		questionsCount, err = c.questionService.CountProductQuestions(productID)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		logrus.Errorf("GetProduct: error in getting product attributes and questions err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting product details")
+		return
+	}
+	product.Questions = &models.Response{
+		TotalRows:  questionsCount,
+		Rows:       questions,
+		NextCursor: questionsPage.Next,
+	}
+
+	ctx.JSON(http.StatusOK, product)
+}
+
+func (c *Controller) CompareProducts(ctx *gin.Context) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(ctx.Query("ids"), ",") {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
 		}
-		url, err := client.Storage.Bucket(product.BucketName).SignedURL(product.Path, signedUrl)
+	}
+	if len(ids) < 2 || len(ids) > maxComparedProducts {
+		err := fmt.Errorf("between 2 and %d product or variant ids are required", maxComparedProducts)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	comparison, err := c.userService.CompareProducts(ids)
+	if errors.Is(err, models.ErrProductNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("CompareProducts: error in comparing products err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in comparing products")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, comparison)
+}
+
+// parseAttributeFilters reads attr.<key>=value, attr.<key>.min and attr.<key>.max from the
+// query string into one filter per attribute key.
+func parseAttributeFilters(query url.Values) ([]models.AttributeFilter, error) {
+	filters := make([]models.AttributeFilter, 0)
+	filterIndex := make(map[string]int)
+	for name, values := range query {
+		if !strings.HasPrefix(name, attributeFilterPrefix) || len(values) == 0 {
+			continue
+		}
+
+		key := strings.TrimPrefix(name, attributeFilterPrefix)
+		bound := ""
+		if strings.HasSuffix(key, ".min") || strings.HasSuffix(key, ".max") {
+			bound = key[len(key)-3:]
+			key = key[:len(key)-4]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("%q has no attribute key", name)
+		}
+
+		index, ok := filterIndex[key]
+		if !ok {
+			index = len(filters)
+			filterIndex[key] = index
+			filters = append(filters, models.AttributeFilter{Key: key})
+		}
+
+		if bound == "" {
+			filters[index].Value = values[0]
+			continue
+		}
+		number, err := strconv.ParseFloat(values[0], 64)
 		if err != nil {
-			logrus.Errorf("GetAllProducts: error in generating image url err: %v", err)
-			responseerror.RespondGenericServerErr(ctx, err, "error in generating image url")
-			return
+			return nil, fmt.Errorf("%q must be a number", name)
+		}
+		if bound == "min" {
+			filters[index].Min = &number
+		} else {
+			filters[index].Max = &number
+		}
+	}
+	return filters, nil
+}
+
+// addCatalogDetails sets the category path, fetched once per category, and the rating of
+// every product.
+func (c *Controller) addCatalogDetails(catalog []models.CatalogProduct) error {
+	categoryIds := make([]string, 0, len(catalog))
+	productIds := make([]string, 0, len(catalog))
+	seen := make(map[string]bool, len(catalog))
+	for _, product := range catalog {
+		productIds = append(productIds, product.Id)
+		if !seen[product.CategoryId] {
+			seen[product.CategoryId] = true
+			categoryIds = append(categoryIds, product.CategoryId)
 		}
+	}
 
+	eg := &errgroup.Group{}
+	var breadcrumbs map[string][]models.Breadcrumb
+	var ratings map[string]models.ReviewSummary
+
+	eg.Go(func() error {
+		var err error
+		breadcrumbs, err = c.searchService.Breadcrumbs(categoryIds)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		ratings, err = c.reviewService.ReviewSummaries(productIds)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	for i := range catalog {
+		catalog[i].Breadcrumbs = breadcrumbs[catalog[i].CategoryId]
+		catalog[i].Rating = ratings[catalog[i].Id]
+	}
+	return nil
+}
+
+// catalogProducts groups rows of one image per variant under their products, keeping the
+// order of the rows, and sums up the price range and stock of each product.
+func (c *Controller) catalogProducts(rows []models.AllProducts) ([]models.CatalogProduct, error) {
+	catalog := make([]models.CatalogProduct, 0)
+	productIndex := make(map[string]int)
+	variantIndex := make(map[string]int)
+	imageIds := make([]string, 0, len(rows))
+	images := make([]models.Images, 0, len(rows))
+	for _, row := range rows {
+		if row.Path != "" {
+			imageIds = append(imageIds, row.ImageID)
+			images = append(images, models.Images{Id: row.ImageID, Path: row.Path, Width: row.Width, Height: row.Height})
+		}
+	}
+	renditions, err := c.userService.GetImageRenditions(imageIds)
+	if err != nil {
+		return nil, err
+	}
+	imageURLs := c.imageURLs.Images(images, renditions)
+
+	for _, row := range rows {
+		pi, ok := productIndex[row.ProductID]
+		if !ok {
+			pi = len(catalog)
+			productIndex[row.ProductID] = pi
+			catalog = append(catalog, models.CatalogProduct{
+				Id:           row.ProductID,
+				ProductName:  row.ProductName,
+				ModelName:    row.ModelName,
+				BrandName:    row.BrandName,
+				BrandSlug:    row.BrandSlug,
+				CategoryId:   row.CategoryID,
+				CategoryName: row.CategoryName,
+				Return:       row.Return,
+				Warranty:     row.Warranty,
+				Wireless:     row.Wireless,
+				Status:       row.Status,
+				MinPrice:     row.Price,
+				MaxPrice:     row.Price,
+				Variants:     []models.CatalogVariant{},
+			})
+		}
+		product := &catalog[pi]
+
+		vi, ok := variantIndex[row.VariantID]
 		if !ok {
-			newProduct := models.Products{
-				Id:           product.VariantID,
-				ProductName:  product.ProductName,
-				ModelName:    product.ModelName,
-				BrandName:    product.BrandName,
-				CategoryName: product.CategoryName,
-				Return:       product.Return,
-				Warranty:     product.Warranty,
-				Wireless:     product.Wireless,
-				Colour:       product.Colour,
-				Price:        product.Price,
-				Stock:        product.Stock,
-				ImageLinks:   []string{url},
+			vi = len(product.Variants)
+			variantIndex[row.VariantID] = vi
+			variant := models.CatalogVariant{
+				Id:         row.VariantID,
+				Colour:     row.Colour,
+				Price:      row.Price,
+				Stock:      row.Stock,
+				ImageLinks: []string{},
+				Images:     []models.ImageURLs{},
 			}
-			productMap[product.VariantID] = newProduct
-		} else {
-			newProduct := models.Products{
-				Id:           product.VariantID,
-				ProductName:  product.ProductName,
-				ModelName:    product.ModelName,
-				BrandName:    product.BrandName,
-				CategoryName: product.CategoryName,
-				Return:       product.Return,
-				Warranty:     product.Warranty,
-				Wireless:     product.Wireless,
-				Colour:       product.Colour,
-				Price:        product.Price,
-				Stock:        product.Stock,
-				ImageLinks:   append(productMap[product.VariantID].ImageLinks, url),
+			if row.CompareAtPrice > row.Price {
+				variant.CompareAtPrice = row.CompareAtPrice
+			}
+			product.Variants = append(product.Variants, variant)
+			product.TotalStock += row.Stock
+			if row.Price < product.MinPrice {
+				product.MinPrice = row.Price
+			}
+			if row.Price > product.MaxPrice {
+				product.MaxPrice = row.Price
 			}
-			productMap[product.VariantID] = newProduct
 		}
-	}
+		if row.Path == "" {
+			continue
+		}
 
-	ctx.JSON(http.StatusOK, models.Response{
-		TotalRows: int64(len(productMap)),
-		Rows:      productMap},
-	)
+		urls := imageURLs[row.ImageID]
+		urls.AltText = row.AltText
+		product.Variants[vi].ImageLinks = append(product.Variants[vi].ImageLinks, urls.Original)
+		product.Variants[vi].Images = append(product.Variants[vi].Images, urls)
+	}
+	return catalog, nil
 }
 
 func (c *Controller) OrderProductByCart(ctx *gin.Context) {
@@ -271,21 +489,28 @@ func (c *Controller) OrderProductByCart(ctx *gin.Context) {
 
 	for _, cartItem := range cartItems {
 		variantIds = append(variantIds, cartItem.VariantId)
-		err := c.userService.UpdateProductStock(cartItem.VariantId, cartItem.Count)
-		if err != nil {
-			logrus.Errorf("OrderProductByCart: error in updating user products stock err: %v", err)
-			responseerror.RespondGenericServerErr(ctx, err, "error in updating user products stock")
-			return
-		}
 	}
 
 	totalPrice, err := c.userService.GetTotalProductCost(variantIds)
+	if errors.Is(err, models.ErrVariantNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "cart contains a variant that is not for sale")
+		return
+	}
 	if err != nil {
 		logrus.Errorf("OrderProductByCart: error in getting user products cost err: %v", err)
 		responseerror.RespondGenericServerErr(ctx, err, "error in getting user products cost")
 		return
 	}
 
+	for _, cartItem := range cartItems {
+		err := c.userService.UpdateProductStock(cartItem.VariantId, cartItem.Count)
+		if err != nil {
+			logrus.Errorf("OrderProductByCart: error in updating user products stock err: %v", err)
+			responseerror.RespondGenericServerErr(ctx, err, "error in updating user products stock")
+			return
+		}
+	}
+
 	if couponCode != "" {
 		totalPrice, err = c.userService.PriceAfterDiscount(totalPrice, couponCode)
 		if err != nil {
@@ -342,11 +567,22 @@ func (c *Controller) GetAllOffers(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, offers)
 }
 
+func (c *Controller) GetActiveOffers(ctx *gin.Context) {
+	offers, err := c.userService.GetActiveOffers()
+	if err != nil {
+		logrus.Errorf("GetActiveOffers: error in getting active offers err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting active offers")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, offers)
+}
+
 func (c *Controller) GetMyOrders(ctx *gin.Context) {
-	limit, page, err := utils.GetLimitPage(ctx)
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest, pagination.SortPrice}, pagination.SortNewest)
 	if err != nil {
-		logrus.Errorf("GetMyFilteredProducts: error in parsing limit and page err: %v", err)
-		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing limit and page")
+		logrus.Errorf("GetMyOrders: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
 		return
 	}
 
@@ -372,30 +608,32 @@ func (c *Controller) GetMyOrders(ctx *gin.Context) {
 	var ordersCount int64
 
 	eg.Go(func() error {
-		orders, err = c.userService.FilterMyOrders(userID, deliveryStatus, limit, page)
-		if err != nil {
-			return err
-		}
-		return nil
+		var err error
+		orders, err = c.userService.FilterMyOrders(userID, deliveryStatus, params)
+		return err
 	})
 
 	eg.Go(func() error {
+		var err error
 		ordersCount, err = c.userService.CountFilterMyOrders(userID, deliveryStatus)
-		if err != nil {
-			return err
-		}
-		return nil
+		return err
 	})
 
 	if err := eg.Wait(); err != nil {
-		logrus.Errorf("GetMyFilteredProducts: error in getting my orders count err: %v", err)
-		responseerror.RespondGenericServerErr(ctx, err, "error in getting my orders count")
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetMyOrders: error in getting my orders err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting my orders")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, models.Response{
-		TotalRows: ordersCount,
-		Rows:      orders,
+		TotalRows:  ordersCount,
+		Rows:       orders,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
 	})
 }
 
@@ -416,3 +654,452 @@ func (c *Controller) AddAddress(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, addressId)
 }
+
+func (c *Controller) ChangePassword(ctx *gin.Context) {
+	passwordDetails := models.ChangePasswordBody{}
+	if parseErr := ctx.ShouldBind(&passwordDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing password details")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	sessionID := ctx.Value("sessionID").(string)
+	user, err := c.userService.GetUserById(userID)
+	if err != nil {
+		logrus.Errorf("ChangePassword: error in getting user details err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting user details")
+		return
+	}
+
+	if !utils.CheckPassword(passwordDetails.OldPassword, user.Password) {
+		responseerror.RespondClientErr(ctx, errors.New("incorrect password"), http.StatusUnauthorized, "incorrect password")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(passwordDetails.NewPassword)
+	if err != nil {
+		logrus.Errorf("ChangePassword: error in password hashing err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, errors.New("error in password hashing"), "error in password hashing")
+		return
+	}
+
+	if err := c.userService.ChangePassword(userID, sessionID, hashedPassword); err != nil {
+		logrus.Errorf("ChangePassword: error in changing password err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in changing password")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "password changed successfully")
+}
+
+func (c *Controller) GetMe(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	user, err := c.userService.GetUserById(userID)
+	if err != nil {
+		logrus.Errorf("GetMe: error in getting user details err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting user details")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Profile{
+		Id:        user.Id,
+		Email:     user.Email,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		CreatedAt: user.CreatedAt,
+	})
+}
+
+func (c *Controller) UpdateMe(ctx *gin.Context) {
+	profileDetails := models.ProfileBody{}
+	if parseErr := ctx.ShouldBind(&profileDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing profile details")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	if err := c.userService.UpdateProfile(userID, &profileDetails); err != nil {
+		logrus.Errorf("UpdateMe: error in updating profile err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in updating profile")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "profile updated successfully")
+}
+
+// confirmPassword is used before sensitive account changes, accounts created through a
+// social login have no password so there is nothing to confirm for them.
+func (c *Controller) confirmPassword(ctx *gin.Context, userID string, password string) (models.Users, bool) {
+	user, err := c.userService.GetUserById(userID)
+	if err != nil {
+		logrus.Errorf("confirmPassword: error in getting user details err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting user details")
+		return user, false
+	}
+
+	if user.Password != "" && !utils.CheckPassword(password, user.Password) {
+		responseerror.RespondClientErr(ctx, errors.New("incorrect password"), http.StatusUnauthorized, "incorrect password")
+		return user, false
+	}
+	return user, true
+}
+
+func (c *Controller) RequestEmailChange(ctx *gin.Context) {
+	emailDetails := models.EmailChangeBody{}
+	if parseErr := ctx.ShouldBind(&emailDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing email details")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	user, ok := c.confirmPassword(ctx, userID, emailDetails.Password)
+	if !ok {
+		return
+	}
+
+	emailInUse, err := c.userService.EmailInUse(emailDetails.Email)
+	if err != nil {
+		logrus.Errorf("RequestEmailChange: error in checking email err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in checking email")
+		return
+	}
+	if emailInUse {
+		responseerror.RespondClientErr(ctx, models.ErrEmailTaken, http.StatusConflict, "email is already in use")
+		return
+	}
+
+	token, err := c.userService.CreateEmailChangeToken(userID, emailDetails.Email)
+	if err != nil {
+		logrus.Errorf("RequestEmailChange: error in creating verification token err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating verification token")
+		return
+	}
+
+	body := fmt.Sprintf("Use the link below to confirm your new email address, it is valid for 24 hours.\n\n%s%s", utils.GetEnvValue("emailChangeUrl"), token)
+	if err := c.mailer.Send(emailDetails.Email, "Confirm your new email address", body); err != nil {
+		logrus.Errorf("RequestEmailChange: error in sending verification mail err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in sending verification mail")
+		return
+	}
+
+	notice := fmt.Sprintf("A change of your account email to %s was requested. If this wasn't you, change your password.", emailDetails.Email)
+	if err := c.mailer.Send(user.Email, "Your email address is being changed", notice); err != nil {
+		logrus.Errorf("RequestEmailChange: error in sending notice mail err: %v", err)
+	}
+
+	ctx.JSON(http.StatusAccepted, "verification mail sent to the new email address")
+}
+
+func (c *Controller) DeleteMe(ctx *gin.Context) {
+	deleteDetails := models.DeleteAccountBody{}
+	if parseErr := ctx.ShouldBind(&deleteDetails); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing account details")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	if _, ok := c.confirmPassword(ctx, userID, deleteDetails.Password); !ok {
+		return
+	}
+
+	if err := c.userService.DeleteAccount(userID); err != nil {
+		logrus.Errorf("DeleteMe: error in deleting account err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in deleting account")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "account deleted successfully")
+}
+
+func (c *Controller) CreateDataExport(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	export, err := c.userService.CreateDataExport(userID)
+	if err != nil {
+		logrus.Errorf("CreateDataExport: error in creating data export err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating data export")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, export)
+}
+
+func (c *Controller) GetDataExport(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	export, err := c.userService.GetDataExport(userID, ctx.Param("exportId"), false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "data export not found")
+			return
+		}
+		logrus.Errorf("GetDataExport: error in getting data export err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting data export")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, export)
+}
+
+func (c *Controller) DownloadDataExport(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	export, err := c.userService.GetDataExport(userID, ctx.Param("exportId"), true)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "data export not found")
+			return
+		}
+		logrus.Errorf("DownloadDataExport: error in getting data export err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting data export")
+		return
+	}
+
+	if export.Status != models.ExportCompleted {
+		responseerror.RespondClientErr(ctx, errors.New("export not ready"), http.StatusConflict, "data export is not completed yet")
+		return
+	}
+
+	if export.ExpiresAt.Before(time.Now()) {
+		responseerror.RespondClientErr(ctx, errors.New("export expired"), http.StatusGone, "data export has expired, request a new one")
+		return
+	}
+
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"audiophile-export-%s.zip\"", export.CreatedAt.Format("2006-01-02")))
+	ctx.Data(http.StatusOK, "application/zip", export.Archive)
+}
+
+// UploadReviewPhoto stores a photo the user can then attach to their review by its id.
+func (c *Controller) UploadReviewPhoto(ctx *gin.Context) {
+	// room for the multipart framing around the largest accepted file
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, imaging.MaxUploadSize+1<<20)
+	if err := ctx.Request.ParseMultipartForm(imaging.MaxUploadSize); err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing photo")
+		return
+	}
+
+	file, _, err := ctx.Request.FormFile("image")
+	if err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing photo")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, imaging.MaxUploadSize+1))
+	if err != nil {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in reading photo")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	image, renditions, err := c.reviewService.UploadReviewPhoto(ctx.Request.Context(), userID, data)
+	if errors.Is(err, models.ErrTooManyPhotos) {
+		responseerror.RespondClientErr(ctx, err, http.StatusTooManyRequests, err.Error())
+		return
+	}
+	if errors.Is(err, imaging.ErrTooLarge) {
+		responseerror.RespondClientErr(ctx, err, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if errors.Is(err, imaging.ErrUnsupportedFormat) {
+		responseerror.RespondClientErr(ctx, err, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("UploadReviewPhoto: error in uploading photo err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in uploading photo")
+		return
+	}
+
+	urls := c.imageURLs.Images([]models.Images{image}, map[string][]models.ImageRendition{image.Id: renditions})
+	ctx.JSON(http.StatusCreated, urls[image.Id])
+}
+
+func (c *Controller) CreateReview(ctx *gin.Context) {
+	body := models.ReviewBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing review")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	reviewID, err := c.reviewService.CreateReview(userID, &body)
+	if errors.Is(err, models.ErrNotVerifiedBuyer) {
+		responseerror.RespondClientErr(ctx, err, http.StatusForbidden, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrReviewExists) {
+		responseerror.RespondClientErr(ctx, err, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, models.ErrInvalidPhotos) {
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("CreateReview: error in creating review err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating review")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, reviewID)
+}
+
+func (c *Controller) GetProductReviews(ctx *gin.Context) {
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest, pagination.SortRating, pagination.SortHelpful}, pagination.SortHelpful)
+	if err != nil {
+		logrus.Errorf("GetProductReviews: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
+
+	productID := ctx.Param("productId")
+	eg := &errgroup.Group{}
+	var reviews []models.ProductReview
+	var reviewsCount int64
+
+	eg.Go(func() error {
+		var err error
+		reviews, err = c.reviewService.GetProductReviews(productID, params)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		reviewsCount, err = c.reviewService.CountProductReviews(productID)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetProductReviews: error in getting reviews err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting reviews")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  reviewsCount,
+		Rows:       reviews,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
+	})
+}
+
+func (c *Controller) AddHelpfulVote(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	err := c.reviewService.AddHelpfulVote(ctx.Param("reviewId"), userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "review not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AddHelpfulVote: error in voting for review err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in voting for review")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "vote recorded")
+}
+
+func (c *Controller) RemoveHelpfulVote(ctx *gin.Context) {
+	userID := ctx.Value("userID").(string)
+	if err := c.reviewService.RemoveHelpfulVote(ctx.Param("reviewId"), userID); err != nil {
+		logrus.Errorf("RemoveHelpfulVote: error in removing vote err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in removing vote")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "vote removed")
+}
+
+func (c *Controller) AskQuestion(ctx *gin.Context) {
+	body := models.QuestionBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing question")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	questionID, err := c.questionService.AskQuestion(userID, ctx.Param("productId"), &body)
+	if errors.Is(err, models.ErrProductNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "product not found")
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AskQuestion: error in creating question err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating question")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, questionID)
+}
+
+func (c *Controller) AnswerQuestion(ctx *gin.Context) {
+	body := models.AnswerBody{}
+	if parseErr := ctx.ShouldBind(&body); parseErr != nil {
+		responseerror.RespondClientErr(ctx, parseErr, http.StatusBadRequest, "error in parsing answer")
+		return
+	}
+
+	userID := ctx.Value("userID").(string)
+	answerID, err := c.questionService.AnswerQuestion(userID, ctx.Param("questionId"), &body, false)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		responseerror.RespondClientErr(ctx, err, http.StatusNotFound, "question not found")
+		return
+	}
+	if errors.Is(err, models.ErrNotProductBuyer) {
+		responseerror.RespondClientErr(ctx, err, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		logrus.Errorf("AnswerQuestion: error in creating answer err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in creating answer")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, answerID)
+}
+
+func (c *Controller) GetProductQuestions(ctx *gin.Context) {
+	params, err := pagination.FromQuery(ctx, []pagination.SortKey{pagination.SortNewest}, pagination.SortNewest)
+	if err != nil {
+		logrus.Errorf("GetProductQuestions: error in parsing pagination err: %v", err)
+		responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "error in parsing pagination")
+		return
+	}
+
+	productID := ctx.Param("productId")
+	eg := &errgroup.Group{}
+	var questions []models.ProductQuestion
+	var questionsCount int64
+
+	eg.Go(func() error {
+		var err error
+		questions, err = c.questionService.GetProductQuestions(productID, params)
+		return err
+	})
+
+	eg.Go(func() error {
+		var err error
+		questionsCount, err = c.questionService.CountProductQuestions(productID)
+		return err
+	})
+
+	if err := eg.Wait(); err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responseerror.RespondClientErr(ctx, err, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		logrus.Errorf("GetProductQuestions: error in getting questions err: %v", err)
+		responseerror.RespondGenericServerErr(ctx, err, "error in getting questions")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, models.Response{
+		TotalRows:  questionsCount,
+		Rows:       questions,
+		NextCursor: params.Next,
+		PrevCursor: params.Prev,
+	})
+}
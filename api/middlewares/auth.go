@@ -3,54 +3,49 @@ package middlewares
 import (
 	"errors"
 	"github.com/Shresth92/audiophile/internal"
-	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/internal/token"
 	"github.com/Shresth92/audiophile/responseerror"
 	"github.com/Shresth92/audiophile/services"
-	"github.com/Shresth92/audiophile/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type AuthMiddleware struct {
-	handler     *internal.RequestHandler
-	authService services.PublicService
+	handler      *internal.RequestHandler
+	authService  services.PublicService
+	tokenManager *token.Manager
 }
 
 func NewAuthMiddleware(
 	handler *internal.RequestHandler,
 	authService services.PublicService,
+	tokenManager *token.Manager,
 ) *AuthMiddleware {
 	return &AuthMiddleware{
-		handler:     handler,
-		authService: authService,
+		handler:      handler,
+		authService:  authService,
+		tokenManager: tokenManager,
 	}
 }
 
 func (m *AuthMiddleware) Setup(ctx *gin.Context) {
-	token := ctx.Request.Header.Get("authorization")
-	claims := &models.Claims{}
+	token := strings.TrimPrefix(ctx.Request.Header.Get("authorization"), "Bearer ")
 	if token == "" {
 		responseerror.RespondClientErr(ctx, errors.New("token not sent in header"), http.StatusUnauthorized, "token not sent in header")
 		ctx.Abort()
 		return
 	} else {
-		parseToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(utils.GetEnvValue("JwtKey")), nil
-		})
+		claims, err := m.tokenManager.Parse(token)
 		if err != nil {
-			if err == jwt.ErrSignatureInvalid {
-				responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "error in validating token")
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "expired token")
 				ctx.Abort()
 				return
 			}
-			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "expired token")
-			ctx.Abort()
-			return
-		}
-		if !parseToken.Valid {
-			responseerror.RespondClientErr(ctx, errors.New("token is not valid"), http.StatusUnauthorized, "token is not valid")
+			responseerror.RespondClientErr(ctx, err, http.StatusUnauthorized, "error in validating token")
 			ctx.Abort()
 			return
 		}
@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type CacheMiddleware struct {
+	handler *internal.RequestHandler
+}
+
+func NewCacheMiddleware(
+	handler *internal.RequestHandler,
+) *CacheMiddleware {
+	return &CacheMiddleware{
+		handler: handler,
+	}
+}
+
+// Public lets browsers and shared caches keep successful responses for maxAge and tags
+// them with an ETag, so revalidating an unchanged response costs a 304 without a body.
+func (m *CacheMiddleware) Public(maxAge time.Duration) gin.HandlerFunc {
+	cacheControl := fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			ctx.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: ctx.Writer, status: http.StatusOK}
+		ctx.Writer = writer
+		ctx.Next()
+		ctx.Writer = writer.ResponseWriter
+
+		if writer.status != http.StatusOK {
+			writer.ResponseWriter.WriteHeader(writer.status)
+			_, _ = writer.ResponseWriter.Write(writer.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(writer.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		header := writer.ResponseWriter.Header()
+		header.Set("Cache-Control", cacheControl)
+		header.Set("ETag", etag)
+		header.Add("Vary", "Accept-Encoding")
+
+		if ctx.GetHeader("If-None-Match") == etag {
+			writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+			writer.ResponseWriter.WriteHeaderNow()
+			return
+		}
+		writer.ResponseWriter.WriteHeader(http.StatusOK)
+		_, _ = writer.ResponseWriter.Write(writer.body.Bytes())
+	}
+}
+
+// bufferedWriter holds back the response until the ETag of the whole body is known.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
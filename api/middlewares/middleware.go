@@ -6,4 +6,5 @@ var Module = fx.Options(
 	fx.Provide(NewAdminMiddleware),
 	fx.Provide(NewUserMiddleware),
 	fx.Provide(NewAuthMiddleware),
+	fx.Provide(NewCacheMiddleware),
 )
@@ -2,31 +2,35 @@ package admin
 
 import (
 	"github.com/Shresth92/audiophile/api/controller/admin"
+	"github.com/Shresth92/audiophile/api/controller/public"
 	"github.com/Shresth92/audiophile/api/controller/user"
 	"github.com/Shresth92/audiophile/api/middlewares"
 	"github.com/Shresth92/audiophile/internal"
 )
 
 type Routes struct {
-	handler         *internal.RequestHandler
-	adminController *admin.Controller
-	userController  *user.Controller
-	authMiddleware  *middlewares.AuthMiddleware
-	adminMiddleware *middlewares.AdminMiddleware
+	handler          *internal.RequestHandler
+	adminController  *admin.Controller
+	userController   *user.Controller
+	publicController *public.Controller
+	authMiddleware   *middlewares.AuthMiddleware
+	adminMiddleware  *middlewares.AdminMiddleware
 }
 
 func NewRoutes(
 	handler *internal.RequestHandler,
 	adminController *admin.Controller,
 	userController *user.Controller,
+	publicController *public.Controller,
 	authMiddleware *middlewares.AuthMiddleware,
 	adminMiddleware *middlewares.AdminMiddleware) *Routes {
 	return &Routes{
-		handler:         handler,
-		adminController: adminController,
-		userController:  userController,
-		authMiddleware:  authMiddleware,
-		adminMiddleware: adminMiddleware,
+		handler:          handler,
+		adminController:  adminController,
+		userController:   userController,
+		publicController: publicController,
+		authMiddleware:   authMiddleware,
+		adminMiddleware:  adminMiddleware,
 	}
 }
 
@@ -35,48 +39,97 @@ func (r *Routes) Setup() {
 	api.Use(r.authMiddleware.Setup)
 	api.Use(r.adminMiddleware.Setup)
 	api.POST("/upload", r.adminController.UploadImages)
+	api.PUT("/password", r.userController.ChangePassword)
+	api.POST("/2fa/recovery-codes", r.publicController.RegenerateRecoveryCodes)
 
 	products := api.Group("/products")
 	{
 		products.POST("/", r.adminController.CreateProduct)
 		products.GET("/", r.userController.GetAllProducts)
+		products.POST("/import", r.adminController.ImportProducts)
+		products.POST("/export", r.adminController.ExportProducts)
+		products.POST("/variants/bulk-update", r.adminController.BulkUpdateVariants)
 
 		productId := products.Group("/:productId")
 		{
 			productId.GET("", r.userController.GetProduct)
 			productId.PUT("", r.adminController.UpdateProduct)
 			productId.DELETE("", r.adminController.DeleteProduct)
+			productId.PUT("/attributes", r.adminController.SetProductAttributes)
+			productId.POST("/publish", r.adminController.PublishProduct)
+			productId.POST("/unpublish", r.adminController.UnpublishProduct)
 
 			variant := productId.Group("/variant")
 			{
 				variant.POST("/", r.adminController.CreateVariant)
-				variant.PUT("/{variantId}", r.adminController.UpdateVariant)
-				variant.DELETE("/{variantId}", r.adminController.DeleteVariant)
+				variant.PUT("/:variantId", r.adminController.UpdateVariant)
+				variant.DELETE("/:variantId", r.adminController.DeleteVariant)
+				variant.PUT("/:variantId/sale", r.adminController.SetVariantSale)
+				variant.DELETE("/:variantId/sale", r.adminController.ClearVariantSale)
+
+				gallery := variant.Group("/:variantId/images")
+				{
+					gallery.GET("", r.adminController.GetVariantGallery)
+					gallery.POST("", r.adminController.AddVariantImages)
+					gallery.PUT("/order", r.adminController.ReorderGallery)
+					gallery.PUT("/:imageId", r.adminController.UpdateGalleryImage)
+					gallery.DELETE("/:imageId", r.adminController.DetachImage)
+				}
 			}
 		}
 	}
 
+	catalogJobs := api.Group("/catalog-jobs")
+	{
+		catalogJobs.GET("/:jobId", r.adminController.GetCatalogJob)
+		catalogJobs.GET("/:jobId/download", r.adminController.DownloadCatalogExport)
+	}
+
+	images := api.Group("/images")
+	{
+		images.GET("/orphans", r.adminController.GetOrphanImages)
+		images.POST("/cleanup", r.adminController.CleanupOrphanImages)
+		images.DELETE("/:imageId", r.adminController.DeleteImage)
+	}
+
 	category := api.Group("/category")
 	{
 		category.POST("/", r.adminController.CreateCategory)
 		category.GET("/", r.adminController.GetAllCategory)
-		category.PUT("/{categoryId}", r.adminController.UpdateCategory)
-		category.DELETE("/{categoryId}", r.adminController.DeleteCategory)
+		category.PUT("/:categoryId", r.adminController.UpdateCategory)
+		category.DELETE("/:categoryId", r.adminController.DeleteCategory)
+		category.GET("/:categoryId/attributes", r.adminController.GetCategoryAttributes)
+		category.POST("/:categoryId/attributes", r.adminController.CreateAttribute)
+		category.DELETE("/:categoryId/attributes/:attributeId", r.adminController.DeleteAttribute)
 	}
 
 	brand := api.Group("/brand")
 	{
 		brand.POST("/", r.adminController.CreateBrand)
 		brand.GET("/", r.adminController.GetAllBrands)
-		brand.PUT("/{brandId}", r.adminController.UpdateBrand)
-		brand.DELETE("/{brandId}", r.adminController.DeleteBrand)
+		brand.PUT("/:brandId", r.adminController.UpdateBrand)
+		brand.DELETE("/:brandId", r.adminController.DeleteBrand)
 	}
 
 	user := api.Group("/user")
 	{
 		user.GET("/", r.adminController.GetAllUsers)
-		user.PUT("/change-role/{userId}", r.adminController.ChangeUserRole)
+		user.PUT("/change-role/:userId", r.adminController.ChangeUserRole)
+	}
+
+	reviews := api.Group("/reviews")
+	{
+		reviews.GET("", r.adminController.GetReviews)
+		reviews.PUT("/:reviewId/status", r.adminController.ModerateReview)
+	}
+
+	questions := api.Group("/questions")
+	{
+		questions.GET("", r.adminController.GetQuestions)
+		questions.POST("/:questionId/answers", r.adminController.AnswerQuestion)
+		questions.PUT("/:questionId/visibility", r.adminController.SetQuestionVisibility)
 	}
+	api.PUT("/answers/:answerId/visibility", r.adminController.SetAnswerVisibility)
 
 	offer := api.Group("/offer")
 	{
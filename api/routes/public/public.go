@@ -1,27 +1,84 @@
 package public
 
 import (
+	"github.com/Shresth92/audiophile/api/controller/admin"
 	"github.com/Shresth92/audiophile/api/controller/public"
+	"github.com/Shresth92/audiophile/api/controller/user"
+	"github.com/Shresth92/audiophile/api/middlewares"
 	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/internal/storage"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	productsMaxAge = time.Minute
+	taxonomyMaxAge = 5 * time.Minute
 )
 
 type Routes struct {
-	handler    *internal.RequestHandler
-	controller *public.Controller
+	handler         *internal.RequestHandler
+	controller      *public.Controller
+	userController  *user.Controller
+	adminController *admin.Controller
+	cacheMiddleware *middlewares.CacheMiddleware
+	store           storage.ObjectStore
 }
 
 func NewRoutes(
 	handler *internal.RequestHandler,
-	controller *public.Controller) *Routes {
+	controller *public.Controller,
+	userController *user.Controller,
+	adminController *admin.Controller,
+	cacheMiddleware *middlewares.CacheMiddleware,
+	store storage.ObjectStore) *Routes {
 	return &Routes{
-		handler:    handler,
-		controller: controller,
+		handler:         handler,
+		controller:      controller,
+		userController:  userController,
+		adminController: adminController,
+		cacheMiddleware: cacheMiddleware,
+		store:           store,
 	}
 }
 
 func (r *Routes) Setup() {
+	r.handler.Gin.GET("/.well-known/jwks.json", r.controller.Jwks)
+
 	api := r.handler.Gin.Group("/public")
 	api.POST("/register", r.controller.Register)
 	api.POST("/login", r.controller.Login)
 	api.POST("/admin-login", r.controller.Login)
+	api.POST("/admin-login/enroll", r.controller.EnrollTotp)
+	api.POST("/admin-login/verify", r.controller.VerifyTwoFactor)
+	api.POST("/forgot-password", r.controller.ForgotPassword)
+	api.POST("/reset-password", r.controller.ResetPassword)
+	api.POST("/verify-email", r.controller.VerifyEmail)
+
+	oidc := api.Group("/oidc/:provider")
+	{
+		oidc.GET("/login", r.controller.OidcLogin)
+		oidc.GET("/callback", r.controller.OidcCallback)
+	}
+
+	// the catalog is read only and the same for everyone, so guests and crawlers can browse
+	// it without a token and caches can serve it
+	products := api.Group("/products", r.cacheMiddleware.Public(productsMaxAge))
+	{
+		products.GET("", r.userController.GetAllProducts)
+		products.GET("/compare", r.userController.CompareProducts)
+		products.GET("/:productId", r.userController.GetProduct)
+		products.GET("/:productId/reviews", r.userController.GetProductReviews)
+		products.GET("/:productId/questions", r.userController.GetProductQuestions)
+	}
+	api.GET("/offers", r.cacheMiddleware.Public(productsMaxAge), r.userController.GetActiveOffers)
+	api.GET("/categories", r.cacheMiddleware.Public(taxonomyMaxAge), r.adminController.GetAllCategory)
+	api.GET("/categories/tree", r.cacheMiddleware.Public(taxonomyMaxAge), r.adminController.GetCategoryTree)
+	api.GET("/brands", r.cacheMiddleware.Public(taxonomyMaxAge), r.adminController.GetAllBrands)
+
+	// stores without a cdn of their own, like the local disk one, serve signed urls here
+	if handler, ok := r.store.(http.Handler); ok {
+		r.handler.Gin.GET(storage.LocalURLPrefix+"*key", gin.WrapH(handler))
+	}
 }
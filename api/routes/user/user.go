@@ -31,12 +31,25 @@ func (r *Routes) Setup() {
 	api.Use(r.authMiddleware.Setup)
 	api.Use(r.userMiddleware.Setup)
 	api.POST("/address", r.controller.AddAddress)
+	api.PUT("/password", r.controller.ChangePassword)
+
+	me := api.Group("/me")
+	{
+		me.GET("", r.controller.GetMe)
+		me.PUT("", r.controller.UpdateMe)
+		me.DELETE("", r.controller.DeleteMe)
+		me.POST("/email", r.controller.RequestEmailChange)
+		me.POST("/export", r.controller.CreateDataExport)
+		me.GET("/export/:exportId", r.controller.GetDataExport)
+		me.GET("/export/:exportId/download", r.controller.DownloadDataExport)
+	}
 	api.GET("/offers", r.controller.GetAllOffers)
 
 	product := api.Group("/products")
 	{
 		product.GET("/", r.controller.GetAllProducts)
 		product.GET("/:productId", r.controller.GetProduct)
+		product.POST("/:productId/questions", r.controller.AskQuestion)
 
 	}
 
@@ -49,6 +62,16 @@ func (r *Routes) Setup() {
 		cart.DELETE("/", r.controller.DeleteMyCart)
 	}
 
+	reviews := api.Group("/reviews")
+	{
+		reviews.POST("", r.controller.CreateReview)
+		reviews.POST("/photos", r.controller.UploadReviewPhoto)
+		reviews.POST("/:reviewId/helpful", r.controller.AddHelpfulVote)
+		reviews.DELETE("/:reviewId/helpful", r.controller.RemoveHelpfulVote)
+	}
+
+	api.POST("/questions/:questionId/answers", r.controller.AnswerQuestion)
+
 	order := api.Group("/order")
 	{
 		order.POST("/", r.controller.OrderProductByCart)
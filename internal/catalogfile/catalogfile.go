@@ -0,0 +1,304 @@
+package catalogfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/models"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxFileSize is the largest import file accepted
+	MaxFileSize = 10 << 20
+	// imageIdSeparator joins the image ids of a row in the imageIds csv column
+	imageIdSeparator = "|"
+	// formulaEscape is put in front of csv text cells a spreadsheet would read as a formula
+	formulaEscape = "'"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("format must be csv or jsonl")
+	ErrInvalidFile       = errors.New("invalid catalog file")
+)
+
+// Columns of csv files in the order they are exported, imported files may order them in
+// any way and leave out the optional ones.
+var Columns = []string{"productName", "modelName", "brand", "category", "return", "warranty", "wireless", "colour", "price", "stock", "imageIds", "attributes"}
+
+var requiredColumns = []string{"productName", "modelName", "brand", "category", "price", "stock"}
+
+// ParseFormat returns the format named by format, or when it is empty the one matching
+// the extension of fileName.
+func ParseFormat(format string, fileName string) (models.CatalogFormat, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(path.Ext(fileName)), ".")
+	}
+	switch format {
+	case "csv":
+		return models.CatalogCSV, nil
+	case "jsonl", "ndjson":
+		return models.CatalogJSONLines, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+func ContentType(format models.CatalogFormat) string {
+	if format == models.CatalogCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Decode reads the rows of a file. Rows that can not be read are returned as row errors,
+// an error is only returned when the file as a whole is unusable.
+func Decode(format models.CatalogFormat, data []byte) ([]models.CatalogRow, []models.ImportRowError, error) {
+	switch format {
+	case models.CatalogCSV:
+		return decodeCSV(data)
+	case models.CatalogJSONLines:
+		return decodeJSONLines(data)
+	}
+	return nil, nil, ErrUnsupportedFormat
+}
+
+func Encode(format models.CatalogFormat, rows []models.CatalogRow) ([]byte, error) {
+	switch format {
+	case models.CatalogCSV:
+		return encodeCSV(rows)
+	case models.CatalogJSONLines:
+		return encodeJSONLines(rows)
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+func decodeCSV(data []byte) ([]models.CatalogRow, []models.ImportRowError, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("%w: file is empty", ErrInvalidFile)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	known := make(map[string]bool, len(Columns))
+	for _, column := range Columns {
+		known[column] = true
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !known[column] {
+			return nil, nil, fmt.Errorf("%w: unknown column %q", ErrInvalidFile, column)
+		}
+		if _, ok := index[column]; ok {
+			return nil, nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidFile, column)
+		}
+		index[column] = i
+	}
+	for _, column := range requiredColumns {
+		if _, ok := index[column]; !ok {
+			return nil, nil, fmt.Errorf("%w: column %q is missing", ErrInvalidFile, column)
+		}
+	}
+
+	var rows []models.CatalogRow
+	var rowErrors []models.ImportRowError
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: parseErr.StartLine, Message: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: line, Message: fmt.Sprintf("expected %d fields but found %d", len(header), len(record))})
+			continue
+		}
+		row, err := csvRow(record, index)
+		if err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: line, Message: err.Error()})
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+func csvRow(record []string, index map[string]int) (models.CatalogRow, error) {
+	field := func(column string) string {
+		if i, ok := index[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	number := func(column string) (int, error) {
+		value := field(column)
+		if value == "" {
+			return 0, nil
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a whole number", column)
+		}
+		return number, nil
+	}
+
+	text := func(column string) string {
+		return unescapeFormula(field(column))
+	}
+
+	row := models.CatalogRow{
+		ProductName: text("productName"),
+		ModelName:   text("modelName"),
+		Brand:       text("brand"),
+		Category:    text("category"),
+		Colour:      text("colour"),
+	}
+	var err error
+	if row.Return, err = number("return"); err != nil {
+		return row, err
+	}
+	if row.Warranty, err = number("warranty"); err != nil {
+		return row, err
+	}
+	if row.Price, err = number("price"); err != nil {
+		return row, err
+	}
+	if row.Stock, err = number("stock"); err != nil {
+		return row, err
+	}
+	if wireless := field("wireless"); wireless != "" {
+		if row.Wireless, err = strconv.ParseBool(wireless); err != nil {
+			return row, errors.New("wireless must be true or false")
+		}
+	}
+	for _, imageId := range strings.Split(field("imageIds"), imageIdSeparator) {
+		if imageId = strings.TrimSpace(imageId); imageId != "" {
+			row.ImageIds = append(row.ImageIds, imageId)
+		}
+	}
+	if attributes := field("attributes"); attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &row.Attributes); err != nil {
+			return row, errors.New("attributes must be a json object")
+		}
+	}
+	return row, nil
+}
+
+func decodeJSONLines(data []byte) ([]models.CatalogRow, []models.ImportRowError, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64<<10), MaxFileSize)
+
+	var rows []models.CatalogRow
+	var rowErrors []models.ImportRowError
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		row := models.CatalogRow{}
+		if err := decoder.Decode(&row); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: line, Message: err.Error()})
+			continue
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return rows, rowErrors, nil
+}
+
+func encodeCSV(rows []models.CatalogRow) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	if err := writer.Write(Columns); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		attributes := ""
+		if len(row.Attributes) > 0 {
+			encoded, err := json.Marshal(row.Attributes)
+			if err != nil {
+				return nil, err
+			}
+			attributes = string(encoded)
+		}
+		err := writer.Write([]string{
+			escapeFormula(row.ProductName),
+			escapeFormula(row.ModelName),
+			escapeFormula(row.Brand),
+			escapeFormula(row.Category),
+			strconv.Itoa(row.Return),
+			strconv.Itoa(row.Warranty),
+			strconv.FormatBool(row.Wireless),
+			escapeFormula(row.Colour),
+			strconv.Itoa(row.Price),
+			strconv.Itoa(row.Stock),
+			strings.Join(row.ImageIds, imageIdSeparator),
+			attributes,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+// isFormula reports whether a spreadsheet would evaluate value as a formula.
+func isFormula(value string) bool {
+	return value != "" && strings.ContainsRune("=+-@", rune(value[0]))
+}
+
+// escapeFormula keeps spreadsheets from running text cells of exports as formulas. Values
+// that already look escaped are escaped once more, so unescapeFormula gives them back.
+func escapeFormula(value string) string {
+	if isFormula(strings.TrimPrefix(value, formulaEscape)) {
+		return formulaEscape + value
+	}
+	return value
+}
+
+// unescapeFormula undoes escapeFormula, so exported files can be imported again.
+func unescapeFormula(value string) string {
+	unescaped := strings.TrimPrefix(value, formulaEscape)
+	if unescaped != value && isFormula(strings.TrimPrefix(unescaped, formulaEscape)) {
+		return unescaped
+	}
+	return value
+}
+
+func encodeJSONLines(rows []models.CatalogRow) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	for _, row := range rows {
+		if err := encoder.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
@@ -40,9 +40,194 @@ func (database *Database) MigrateUpDb() {
 		logrus.Errorf("enum creation failed; err: %s", err)
 	}
 
-	if err := database.DB.AutoMigrate(&models.Users{}, &models.UserRole{}, &models.Address{}, &models.Session{}, &models.Category{}, &models.Brand{}, &models.Product{}, &models.Variants{}, &models.Offer{}, &models.Images{}, &models.VariantImages{}, &models.Orders{}, &models.ProductOrdered{}, &models.UserCart{}); err != nil {
+	if err := database.DB.Exec("CREATE TYPE token_purpose AS ENUM ('passwordReset')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("ALTER TYPE token_purpose ADD VALUE IF NOT EXISTS 'emailChange'").Error; err != nil {
+		logrus.Errorf("enum alteration failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("CREATE TYPE export_status AS ENUM ('pending','running','completed','failed')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("CREATE TYPE attribute_type AS ENUM ('text','number','boolean','list')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("CREATE TYPE review_status AS ENUM ('pending','approved','hidden')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("CREATE TYPE catalog_job_kind AS ENUM ('import','export')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	if err := database.DB.Exec("CREATE TYPE product_status AS ENUM ('draft','published','archived')").Error; err != nil {
+		logrus.Errorf("enum creation failed; err: %s", err)
+	}
+
+	database.migrateProductStatus()
+
+	if err := database.DB.AutoMigrate(&models.Users{}, &models.UserRole{}, &models.Address{}, &models.Session{}, &models.Category{}, &models.Brand{}, &models.Product{}, &models.Variants{}, &models.Offer{}, &models.Images{}, &models.ImageRendition{}, &models.VariantImages{}, &models.Orders{}, &models.ProductOrdered{}, &models.UserCart{}, &models.UserToken{}, &models.LoginThrottle{}, &models.UserIdentity{}, &models.OidcLoginState{}, &models.UserTotp{}, &models.RecoveryCode{}, &models.LoginChallenge{}, &models.DataExport{}, &models.Attribute{}, &models.ProductAttributeValue{}, &models.Review{}, &models.ReviewImage{}, &models.ReviewVote{}, &models.Question{}, &models.Answer{}, &models.CatalogJob{}); err != nil {
 		logrus.Errorf("automigration failed; err: %s", err.Error())
 	}
+
+	database.migrateCategories()
+	database.migrateProductSearch()
+	database.migrateVariantImages()
+	database.migrateVariantPricing()
+}
+
+// migrateProductStatus adds the status column ahead of automigration, so products created
+// before drafts existed stay visible as published, or archived when deleted, while new
+// products start out as drafts.
+func (database *Database) migrateProductStatus() {
+	statement := `DO $$ BEGIN
+		IF to_regclass('products') IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM information_schema.columns WHERE table_name = 'products' AND column_name = 'status'
+		) THEN
+			ALTER TABLE products ADD COLUMN status product_status NOT NULL DEFAULT 'published';
+			UPDATE products SET status = 'archived' WHERE archived_at IS NOT NULL;
+			ALTER TABLE products ALTER COLUMN status SET DEFAULT 'draft';
+		END IF;
+	END $$`
+
+	if err := database.DB.Exec(statement).Error; err != nil {
+		logrus.Errorf("product status migration failed; err: %s", err)
+	}
+}
+
+// migrateCategories adds the primary key categories were created without and gives
+// existing categories and brands a unique slug derived from their name.
+func (database *Database) migrateCategories() {
+	statements := []string{
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'categories'::regclass AND contype = 'p') THEN
+				ALTER TABLE categories ADD PRIMARY KEY (id);
+			END IF;
+		END $$`,
+	}
+	for _, table := range []struct{ name, column string }{{"categories", "category_name"}, {"brands", "brand_name"}} {
+		statements = append(statements,
+			fmt.Sprintf(`WITH base AS (
+				SELECT id, coalesce(nullif(trim(both '-' from regexp_replace(lower(%[2]s), '[^a-z0-9]+', '-', 'g')), ''), id) AS slug
+				FROM %[1]s WHERE slug IS NULL OR slug = ''
+			), numbered AS (
+				SELECT id, slug, row_number() OVER (PARTITION BY slug ORDER BY id) AS position FROM base
+			)
+			UPDATE %[1]s SET slug = CASE WHEN numbered.position = 1 THEN numbered.slug ELSE numbered.slug || '-' || numbered.position END
+			FROM numbered WHERE %[1]s.id = numbered.id`, table.name, table.column),
+			fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS unique_%[1]s_slug ON %[1]s (slug) WHERE archived_at IS NULL", table.name),
+		)
+	}
+
+	for _, statement := range statements {
+		if err := database.DB.Exec(statement).Error; err != nil {
+			logrus.Errorf("category migration failed; err: %s", err)
+			return
+		}
+	}
+}
+
+// migrateProductSearch keeps products.search_vector, the document product search runs
+// against, in sync through triggers so brand and category renames are reflected as well.
+func (database *Database) migrateProductSearch() {
+	statements := []string{
+		"ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector",
+		`CREATE OR REPLACE FUNCTION products_search_vector(p_product_name text, p_model_name text, p_brand_id text, p_category_id text) RETURNS tsvector AS $$
+			SELECT setweight(to_tsvector('english', coalesce(p_product_name, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(p_model_name, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce((SELECT brand_name FROM brands WHERE id = p_brand_id), '')), 'B') ||
+				setweight(to_tsvector('english', coalesce((SELECT category_name FROM categories WHERE id = p_category_id), '')), 'C')
+		$$ LANGUAGE sql STABLE`,
+		`CREATE OR REPLACE FUNCTION products_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := products_search_vector(NEW.product_name, NEW.model_name, NEW.brand_id, NEW.category_id);
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`CREATE OR REPLACE FUNCTION brands_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			UPDATE products SET search_vector = products_search_vector(product_name, model_name, brand_id, category_id) WHERE brand_id = NEW.id;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`CREATE OR REPLACE FUNCTION categories_search_vector_trigger() RETURNS trigger AS $$
+		BEGIN
+			UPDATE products SET search_vector = products_search_vector(product_name, model_name, brand_id, category_id) WHERE category_id = NEW.id;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		"DROP TRIGGER IF EXISTS products_search_vector_update ON products",
+		"CREATE TRIGGER products_search_vector_update BEFORE INSERT OR UPDATE OF product_name, model_name, brand_id, category_id ON products FOR EACH ROW EXECUTE FUNCTION products_search_vector_trigger()",
+		"DROP TRIGGER IF EXISTS brands_search_vector_update ON brands",
+		"CREATE TRIGGER brands_search_vector_update AFTER UPDATE OF brand_name ON brands FOR EACH ROW EXECUTE FUNCTION brands_search_vector_trigger()",
+		"DROP TRIGGER IF EXISTS categories_search_vector_update ON categories",
+		"CREATE TRIGGER categories_search_vector_update AFTER UPDATE OF category_name ON categories FOR EACH ROW EXECUTE FUNCTION categories_search_vector_trigger()",
+		"UPDATE products SET search_vector = products_search_vector(product_name, model_name, brand_id, category_id) WHERE search_vector IS NULL",
+		"CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING gin (search_vector)",
+	}
+
+	for _, statement := range statements {
+		if err := database.DB.Exec(statement).Error; err != nil {
+			logrus.Errorf("product search migration failed; err: %s", err)
+			return
+		}
+	}
+}
+
+// migrateVariantImages drops images attached twice to the same variant and orders the
+// galleries created before images had a position by upload time, making the first image
+// primary. Each variant can then have a single primary image.
+func (database *Database) migrateVariantImages() {
+	statements := []string{
+		`UPDATE variant_images SET archived_at = now() WHERE archived_at IS NULL AND id NOT IN (
+			SELECT DISTINCT ON (variant_id, image_id) id FROM variant_images
+			WHERE archived_at IS NULL ORDER BY variant_id, image_id, created_at, id
+		)`,
+		`WITH unordered AS (
+			SELECT variant_id FROM variant_images WHERE archived_at IS NULL
+			GROUP BY variant_id HAVING NOT bool_or(is_primary)
+		), numbered AS (
+			SELECT vi.id, row_number() OVER (PARTITION BY vi.variant_id ORDER BY vi.position, vi.created_at, vi.id) AS position
+			FROM variant_images vi JOIN unordered u ON u.variant_id = vi.variant_id
+			WHERE vi.archived_at IS NULL
+		)
+		UPDATE variant_images SET position = numbered.position, is_primary = numbered.position = 1
+		FROM numbered WHERE variant_images.id = numbered.id`,
+		"CREATE UNIQUE INDEX IF NOT EXISTS unique_variant_images_primary ON variant_images (variant_id) WHERE is_primary AND archived_at IS NULL",
+		"CREATE UNIQUE INDEX IF NOT EXISTS unique_variant_images_image ON variant_images (variant_id, image_id) WHERE archived_at IS NULL",
+	}
+
+	for _, statement := range statements {
+		if err := database.DB.Exec(statement).Error; err != nil {
+			logrus.Errorf("variant images migration failed; err: %s", err)
+			return
+		}
+	}
+}
+
+// migrateVariantPricing defines effective_price, the price a variant sells for at the time
+// of the query. Catalog, search and checkout all price variants with it so a sale starts
+// and ends everywhere at once.
+func (database *Database) migrateVariantPricing() {
+	statements := []string{
+		`CREATE OR REPLACE FUNCTION effective_price(v variants) RETURNS integer AS $$
+			SELECT CASE WHEN v.sale_price IS NOT NULL AND v.sale_price < v.price
+				AND (v.sale_starts_at IS NULL OR v.sale_starts_at <= now())
+				AND (v.sale_ends_at IS NULL OR v.sale_ends_at > now())
+			THEN v.sale_price ELSE v.price END
+		$$ LANGUAGE sql STABLE`,
+	}
+
+	for _, statement := range statements {
+		if err := database.DB.Exec(statement).Error; err != nil {
+			logrus.Errorf("variant pricing migration failed; err: %s", err)
+			return
+		}
+	}
 }
 
 func (database *Database) CloseDb() error {
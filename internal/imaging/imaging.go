@@ -0,0 +1,322 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxUploadSize is the largest image file accepted
+	MaxUploadSize = 10 << 20
+	// maxPixels guards against small files that decode into huge bitmaps
+	maxPixels   = 40_000_000
+	jpegQuality = 85
+	// originalQuality is higher than that of the renditions since originals are re-encoded
+	// only to drop their metadata
+	originalQuality = 92
+	// webpSuffix names the webp copy of a rendition, like largeWebp
+	webpSuffix = "Webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("file is not a jpeg, png or gif image")
+	ErrTooLarge          = errors.New("image is too large")
+)
+
+// Rendition is a downscaled copy of uploaded images that fits within MaxSide pixels,
+// images already smaller keep their size.
+type Rendition struct {
+	Name    string
+	MaxSide int
+}
+
+// Renditions are listed from the largest down, each one is scaled from the previous.
+var Renditions = []Rendition{
+	{Name: "large", MaxSide: 1600},
+	{Name: "medium", MaxSide: 800},
+	{Name: "thumbnail", MaxSide: 200},
+}
+
+type Encoded struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	Extension   string
+	Data        []byte
+}
+
+// Processed is a verified upload along with its renditions, every rendition is followed by
+// its webp copy when the app is built with cgo. Data holds the original re-encoded without the metadata of the upload,
+// such as the location a photo was taken at, and turned upright. Jpeg uploads are
+// re-encoded as jpeg, png and gif ones as png to keep their transparency.
+type Processed struct {
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+	Data        []byte
+	Renditions  []Encoded
+}
+
+var supportedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// Process checks data really is an image of a supported format by sniffing and decoding
+// it, then re-encodes the original and renders every rendition.
+func Process(data []byte) (*Processed, error) {
+	if len(data) > MaxUploadSize {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !supportedTypes[contentType] {
+		return nil, ErrUnsupportedFormat
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	var decoded image.Image
+	switch contentType {
+	case "image/jpeg":
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		decoded, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		decoded, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	source := toRGBA(decoded)
+	if contentType == "image/jpeg" {
+		source = orient(source, exifOrientation(data))
+	}
+	original, err := encode(source, contentType == "image/jpeg", originalQuality)
+	if err != nil {
+		return nil, err
+	}
+	processed := &Processed{
+		ContentType: original.ContentType,
+		Extension:   original.Extension,
+		Width:       source.Bounds().Dx(),
+		Height:      source.Bounds().Dy(),
+		Data:        original.Data,
+	}
+
+	for _, rendition := range Renditions {
+		width, height := fit(source.Bounds().Dx(), source.Bounds().Dy(), rendition.MaxSide)
+		source = resize(source, width, height)
+
+		encoded, err := encode(source, contentType == "image/jpeg", jpegQuality)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Name = rendition.Name
+		processed.Renditions = append(processed.Renditions, encoded)
+
+		if !webpSupported {
+			continue
+		}
+		webpData, err := encodeWebp(source)
+		if err != nil {
+			return nil, err
+		}
+		processed.Renditions = append(processed.Renditions, Encoded{
+			Name:        rendition.Name + webpSuffix,
+			Width:       width,
+			Height:      height,
+			ContentType: "image/webp",
+			Extension:   ".webp",
+			Data:        webpData,
+		})
+	}
+	return processed, nil
+}
+
+// encode writes img as jpeg of the given quality, or as png to keep its transparency.
+func encode(img *image.RGBA, asJpeg bool, quality int) (Encoded, error) {
+	encoded := Encoded{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	buffer := &bytes.Buffer{}
+	var err error
+	if asJpeg {
+		encoded.ContentType, encoded.Extension = "image/jpeg", ".jpg"
+		err = jpeg.Encode(buffer, img, &jpeg.Options{Quality: quality})
+	} else {
+		encoded.ContentType, encoded.Extension = "image/png", ".png"
+		err = png.Encode(buffer, img)
+	}
+	encoded.Data = buffer.Bytes()
+	return encoded, err
+}
+
+// exifOrientation returns the orientation tag of a jpeg, 1 for upright when it has none.
+func exifOrientation(data []byte) int {
+	const orientationTag = 0x0112
+	// segments follow the start of image marker until the image data starts
+	for offset := 2; offset+4 <= len(data) && data[offset] == 0xFF; {
+		marker := data[offset+1]
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if marker == 0xDA || length < 2 || offset+2+length > len(data) {
+			break
+		}
+		segment := data[offset+4 : offset+2+length]
+		offset += 2 + length
+		if marker != 0xE1 || len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+			continue
+		}
+
+		tiff := segment[6:]
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < entries; i++ {
+			entry := ifd + 2 + i*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if order.Uint16(tiff[entry:]) == orientationTag {
+				if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+					return orientation
+				}
+				return 1
+			}
+		}
+		return 1
+	}
+	return 1
+}
+
+// orient turns img upright according to its exif orientation, orientations 5 to 8 swap
+// the width and height.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for dy := 0; dy < dstHeight; dy++ {
+		for dx := 0; dx < dstWidth; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = width-1-dx, dy
+			case 3:
+				sx, sy = width-1-dx, height-1-dy
+			case 4:
+				sx, sy = dx, height-1-dy
+			case 5:
+				sx, sy = dy, dx
+			case 6:
+				sx, sy = dy, height-1-dx
+			case 7:
+				sx, sy = width-1-dy, height-1-dx
+			case 8:
+				sx, sy = width-1-dy, dx
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+	return dst
+}
+
+// fit scales width and height down to fit within maxSide, keeping the aspect ratio.
+func fit(width int, height int, maxSide int) (int, int) {
+	if width <= maxSide && height <= maxSide {
+		return width, height
+	}
+	if width >= height {
+		return maxSide, max(1, height*maxSide/width)
+	}
+	return max(1, width*maxSide/height), maxSide
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+// resize downscales with a box filter, every destination pixel averages the source pixels
+// it covers. The pixels are alpha premultiplied so transparent ones do not bleed colour.
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * srcHeight / height
+		y1 := max(y0+1, (dy+1)*srcHeight/height)
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * srcWidth / width
+			x1 := max(x0+1, (dx+1)*srcWidth/width)
+
+			var r, g, b, a, count uint64
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					pixel := row[x*4 : x*4+4]
+					r += uint64(pixel[0])
+					g += uint64(pixel[1])
+					b += uint64(pixel[2])
+					a += uint64(pixel[3])
+					count++
+				}
+			}
+			offset := dy*dst.Stride + dx*4
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
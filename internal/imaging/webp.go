@@ -0,0 +1,22 @@
+//go:build cgo
+
+package imaging
+
+import (
+	"bytes"
+	"github.com/chai2010/webp"
+	"image"
+)
+
+const webpQuality = 80
+
+// webpSupported is only true in cgo builds, the webp encoder wraps libwebp.
+const webpSupported = true
+
+func encodeWebp(img *image.RGBA) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := webp.Encode(buffer, img, &webp.Options{Quality: webpQuality}); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
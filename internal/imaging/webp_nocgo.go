@@ -0,0 +1,15 @@
+//go:build !cgo
+
+package imaging
+
+import (
+	"errors"
+	"image"
+)
+
+// webpSupported is false without cgo, renditions then only come as jpeg or png.
+const webpSupported = false
+
+func encodeWebp(*image.RGBA) ([]byte, error) {
+	return nil, errors.New("webp encoding needs a cgo build")
+}
@@ -1,8 +1,18 @@
 package internal
 
-import "go.uber.org/fx"
+import (
+	"github.com/Shresth92/audiophile/internal/oidc"
+	"github.com/Shresth92/audiophile/internal/storage"
+	"github.com/Shresth92/audiophile/internal/token"
+	"go.uber.org/fx"
+)
 
 var Module = fx.Options(
 	fx.Provide(NewRequestHandler),
 	fx.Provide(NewDatabase),
+	fx.Provide(NewMailer),
+	fx.Provide(oidc.NewProviders),
+	fx.Provide(token.NewManager),
+	fx.Provide(storage.NewObjectStore),
+	fx.Provide(storage.NewImageURLService),
 )
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/sirupsen/logrus"
+	"net/smtp"
+	"strings"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+type logMailer struct{}
+
+// NewMailer returns an SMTP backed mailer when smtpHost is configured, otherwise
+// mails are only logged which is enough for local development.
+func NewMailer() Mailer {
+	host := utils.GetEnvValue("smtpHost")
+	if host == "" {
+		logrus.Warn("smtpHost is not set, outgoing mails will only be logged")
+		return &logMailer{}
+	}
+
+	port := utils.GetEnvValue("smtpPort")
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username := utils.GetEnvValue("smtpUser"); username != "" {
+		auth = smtp.PlainAuth("", username, utils.GetEnvValue("smtpPassword"), host)
+	}
+
+	return &smtpMailer{
+		addr: host + ":" + port,
+		auth: auth,
+		from: utils.GetEnvValue("smtpFrom"),
+	}
+}
+
+func (m *smtpMailer) Send(to string, subject string, body string) error {
+	headers := []string{
+		fmt.Sprintf("From: %s", m.from),
+		fmt.Sprintf("To: %s", to),
+		fmt.Sprintf("Subject: %s", subject),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"utf-8\"",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message))
+}
+
+func (m *logMailer) Send(to string, subject string, body string) error {
+	logrus.Infof("mail to: %s subject: %s body: %s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,310 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/oauth2"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	httpTimeout = 10 * time.Second
+	// jwksRefreshInterval limits how often unknown key ids trigger a refetch of the provider keys
+	jwksRefreshInterval = time.Minute
+)
+
+// ProviderConfig is one entry of the OidcProviders env value, which holds a json array of these.
+// Issuer may point to any OIDC compliant server, including a local mock one for testing.
+type ProviderConfig struct {
+	Name         string   `json:"name"`
+	Issuer       string   `json:"issuer"`
+	ClientId     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectUrl  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+}
+
+type Providers map[string]*Provider
+
+type Provider struct {
+	config     ProviderConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *discoveryDocument
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type IdentityClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// NewProviders reads the configured providers, discovery documents are fetched lazily so
+// the service can start while a provider is unreachable.
+func NewProviders() (Providers, error) {
+	providers := Providers{}
+	rawConfig := utils.GetEnvValue("OidcProviders")
+	if rawConfig == "" {
+		return providers, nil
+	}
+
+	var configs []ProviderConfig
+	if err := json.Unmarshal([]byte(rawConfig), &configs); err != nil {
+		return providers, fmt.Errorf("parsing OidcProviders: %w", err)
+	}
+
+	for _, config := range configs {
+		if config.Name == "" || config.Issuer == "" || config.ClientId == "" || config.RedirectUrl == "" {
+			return providers, fmt.Errorf("oidc provider %q is missing name, issuer, clientId or redirectUrl", config.Name)
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers[config.Name] = &Provider{
+			config:     config,
+			httpClient: &http.Client{Timeout: httpTimeout},
+		}
+	}
+	return providers, nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for a code verifier.
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeVerifier string) (string, error) {
+	oauthConfig, err := p.oauthConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauthConfig.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", CodeChallenge(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	), nil
+}
+
+// Exchange redeems the authorization code and returns the verified claims of the id token.
+func (p *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*IdentityClaims, error) {
+	oauthConfig, err := p.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.verifyIDToken(ctx, rawIDToken, nonce)
+}
+
+func (p *Provider) verifyIDToken(ctx context.Context, rawIDToken string, nonce string) (*IdentityClaims, error) {
+	claims := &IdentityClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("unexpected id token issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.config.ClientId, true) {
+		return nil, errors.New("id token was not issued for this client")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	return claims, nil
+}
+
+func (p *Provider) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.config.ClientId,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+		RedirectURL: p.config.RedirectUrl,
+		Scopes:      p.config.Scopes,
+	}, nil
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &discoveryDocument{}
+	wellKnown := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", discovery.Issuer, p.config.Issuer)
+	}
+
+	p.discovery = discovery
+	return discovery, nil
+}
+
+func (p *Provider) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JwksUri, &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, webKey := range keySet.Keys {
+		key, err := webKey.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[webKey.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
@@ -0,0 +1,178 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId = "audiophile"
+	testCode     = "authorization-code"
+	testKeyId    = "test-key"
+)
+
+// mockProvider is a minimal OIDC server that hands out an id token for testCode when the
+// PKCE verifier matches the challenge of the authorization request.
+type mockProvider struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	codeChallenge string
+	nonce         string
+	emailVerified bool
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &mockProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(discoveryDocument{
+			Issuer:                mock.server.URL,
+			AuthorizationEndpoint: mock.server.URL + "/authorize",
+			TokenEndpoint:         mock.server.URL + "/token",
+			JwksUri:               mock.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string][]jsonWebKey{"keys": {{
+			Kid: testKeyId,
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != testCode {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		if CodeChallenge(r.PostForm.Get("code_verifier")) != mock.codeChallenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, IdentityClaims{
+			Email:         "shopper@example.com",
+			EmailVerified: mock.emailVerified,
+			Nonce:         mock.nonce,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    mock.server.URL,
+				Subject:   "subject-1",
+				Audience:  jwt.ClaimStrings{testClientId},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = testKeyId
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   60,
+			"id_token":     idToken,
+		})
+	})
+	mock.server = httptest.NewServer(mux)
+	t.Cleanup(mock.server.Close)
+	return mock
+}
+
+func (m *mockProvider) provider() *Provider {
+	return &Provider{
+		config: ProviderConfig{
+			Name:        "mock",
+			Issuer:      m.server.URL,
+			ClientId:    testClientId,
+			RedirectUrl: "http://localhost/public/oidc/mock/callback",
+			Scopes:      []string{"openid", "email"},
+		},
+		httpClient: m.server.Client(),
+	}
+}
+
+// authorize plays the browser leg of the flow, it checks the authorization request and
+// remembers its challenge and nonce the way a provider would.
+func (m *mockProvider) authorize(t *testing.T, provider *Provider, state string, nonce string, codeVerifier string) {
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, codeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("state") != state || query.Get("code_challenge_method") != "S256" || query.Get("client_id") != testClientId {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+	m.codeChallenge = query.Get("code_challenge")
+	m.nonce = query.Get("nonce")
+}
+
+func TestExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.emailVerified = true
+	provider := mock.provider()
+	mock.authorize(t, provider, "state", "nonce", "code-verifier")
+
+	claims, err := provider.Exchange(context.Background(), testCode, "code-verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "shopper@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	mock.authorize(t, provider, "state", "nonce", "code-verifier")
+
+	if _, err := provider.Exchange(context.Background(), testCode, "another-verifier", "nonce"); err == nil {
+		t.Fatal("expected the exchange to fail with a wrong code verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	mock.authorize(t, provider, "state", "nonce", "code-verifier")
+
+	if _, err := provider.Exchange(context.Background(), testCode, "code-verifier", "another-nonce"); err == nil {
+		t.Fatal("expected the exchange to fail with a wrong nonce")
+	}
+}
+
+func TestExchangeReportsUnverifiedEmail(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := mock.provider()
+	mock.authorize(t, provider, "state", "nonce", "code-verifier")
+
+	claims, err := provider.Exchange(context.Background(), testCode, "code-verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified {
+		t.Fatal("expected the email to be reported as unverified")
+	}
+}
@@ -1,18 +1,32 @@
 package internal
 
 import (
+	"fmt"
+	"github.com/Shresth92/audiophile/utils"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"strings"
 )
 
 type RequestHandler struct {
 	Gin *gin.Engine
 }
 
-// NewRequestHandler creates a new request handler
-func NewRequestHandler() *RequestHandler {
+// NewRequestHandler creates a new request handler. X-Forwarded-For is only believed when
+// the request comes from one of the comma separated addresses or CIDRs in trustedProxies,
+// without it the client ip is the address of the connection.
+func NewRequestHandler() (*RequestHandler, error) {
 	engine := gin.New()
 	engine.ForwardedByClientIP = true
+	var trustedProxies []string
+	for _, proxy := range strings.Split(utils.GetEnvValue("trustedProxies"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := engine.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("parsing trustedProxies: %w", err)
+	}
 	engine.Use(gin.Recovery())
 	engine.Use(func(c *gin.Context) {
 		c.Header("Content-Type", "application/json")
@@ -23,5 +37,5 @@ func NewRequestHandler() *RequestHandler {
 			"responseerror": "Page not found",
 		})
 	})
-	return &RequestHandler{Gin: engine}
+	return &RequestHandler{Gin: engine}, nil
 }
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	cloud "cloud.google.com/go/storage"
+	"context"
+	"errors"
+	"google.golang.org/api/option"
+	"io"
+	"time"
+)
+
+type GCSStore struct {
+	client *cloud.Client
+	bucket string
+}
+
+// NewGCSStore connects with the service account in credentialsJSON, which also signs the URLs.
+func NewGCSStore(ctx context.Context, bucket string, credentialsJSON string) (*GCSStore, error) {
+	client, err := cloud.NewClient(ctx, option.WithCredentialsJSON([]byte(credentialsJSON)))
+	if err != nil {
+		return nil, err
+	}
+	return &GCSStore{client: client, bucket: bucket}, nil
+}
+
+func (s *GCSStore) Bucket() string {
+	return s.bucket
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	writer := s.client.Bucket(s.bucket).Object(key).NewWriter(ctx)
+	writer.ContentType = contentType
+	if _, err := io.Copy(writer, content); err != nil {
+		_ = writer.Close()
+		return err
+	}
+	// the object is only committed once the writer is closed
+	return writer.Close()
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	err := s.client.Bucket(s.bucket).Object(key).Delete(ctx)
+	if errors.Is(err, cloud.ErrObjectNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (s *GCSStore) SignedURL(key string, expires time.Duration) (string, error) {
+	return s.client.Bucket(s.bucket).SignedURL(key, &cloud.SignedURLOptions{
+		Scheme:  cloud.SigningSchemeV4,
+		Method:  "GET",
+		Expires: time.Now().Add(expires),
+	})
+}
+
+func (s *GCSStore) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if errors.Is(err, cloud.ErrObjectNotExist) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:         key,
+		Size:        attrs.Size,
+		ContentType: attrs.ContentType,
+		UpdatedAt:   attrs.Updated,
+	}, nil
+}
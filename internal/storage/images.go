@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/Shresth92/audiophile/internal/imaging"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// StoreImage validates an upload and puts it into the store under images/<id>/ along with
+// its renditions, then hands the rows describing them to record. The original is stored
+// re-encoded without its metadata. The stored objects are removed again when storing or
+// recording fails.
+func StoreImage(ctx context.Context, store ObjectStore, data []byte, record func(*models.Images, []models.ImageRendition) error) (models.Images, []models.ImageRendition, error) {
+	processed, err := imaging.Process(data)
+	if err != nil {
+		return models.Images{}, nil, err
+	}
+
+	imageId := uuid.New().String()
+	prefix := "images/" + imageId + "/"
+	image := models.Images{
+		Id:          imageId,
+		BucketName:  store.Bucket(),
+		Path:        prefix + "original" + processed.Extension,
+		ContentType: processed.ContentType,
+		Width:       processed.Width,
+		Height:      processed.Height,
+		Size:        int64(len(processed.Data)),
+	}
+	renditions := make([]models.ImageRendition, 0, len(processed.Renditions))
+	for _, rendition := range processed.Renditions {
+		renditions = append(renditions, models.ImageRendition{
+			Id:          uuid.New().String(),
+			ImageId:     imageId,
+			Name:        rendition.Name,
+			Path:        prefix + rendition.Name + rendition.Extension,
+			ContentType: rendition.ContentType,
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+		})
+	}
+
+	stored := make([]string, 0, len(renditions)+1)
+	err = store.Put(ctx, image.Path, bytes.NewReader(processed.Data), image.ContentType)
+	if err == nil {
+		stored = append(stored, image.Path)
+		for i, rendition := range renditions {
+			if err = store.Put(ctx, rendition.Path, bytes.NewReader(processed.Renditions[i].Data), rendition.ContentType); err != nil {
+				break
+			}
+			stored = append(stored, rendition.Path)
+		}
+	}
+	if err == nil {
+		err = record(&image, renditions)
+	}
+	if err != nil {
+		for _, path := range stored {
+			if deleteErr := store.Delete(ctx, path); deleteErr != nil {
+				logrus.Errorf("StoreImage: error in removing %s err: %v", path, deleteErr)
+			}
+		}
+		return models.Images{}, nil, err
+	}
+	return image, renditions, nil
+}
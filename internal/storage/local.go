@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLocalDir = "storage"
+	// LocalURLPrefix is the path the local store serves its signed URLs under
+	LocalURLPrefix = "/public/storage/"
+)
+
+// LocalStore keeps objects as files under a directory. Its signed URLs point at our own
+// server, which checks the HMAC signature and expiry before serving the file.
+type LocalStore struct {
+	root       string
+	signingKey []byte
+	baseUrl    string
+}
+
+// NewLocalStore stores files under dir, signingKey must be shared by all instances serving
+// the same files. Without it an ephemeral key is generated and links break on restart.
+func NewLocalStore(dir string, signingKey string, baseUrl string) (*LocalStore, error) {
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	key := []byte(signingKey)
+	if len(key) == 0 {
+		logrus.Warn("storageSigningKey is not set, signing storage urls with an ephemeral key")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{
+		root:       dir,
+		signingKey: key,
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+	}, nil
+}
+
+func (s *LocalStore) Bucket() string {
+	return "local"
+}
+
+func (s *LocalStore) Put(_ context.Context, key string, content io.Reader, _ string) error {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o750); err != nil {
+		return err
+	}
+
+	// written next to its destination first so readers never see a partial file
+	file, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filePath)
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrObjectNotFound
+	}
+	return err
+}
+
+func (s *LocalStore) SignedURL(key string, expires time.Duration) (string, error) {
+	if _, err := s.filePath(key); err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", s.signature(key, expiresAt))
+	return s.baseUrl + LocalURLPrefix + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) Stat(_ context.Context, key string) (ObjectInfo, error) {
+	filePath, err := s.filePath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrObjectNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		UpdatedAt:   info.ModTime(),
+	}, nil
+}
+
+// ServeHTTP serves the object a signed URL points at, the key is the request path after
+// LocalURLPrefix.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, LocalURLPrefix)
+	expiresAt := r.URL.Query().Get("expires")
+	expiresUnix, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || time.Now().Unix() > expiresUnix ||
+		!hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(s.signature(key, expiresAt))) {
+		http.Error(w, "link is invalid or expired", http.StatusForbidden)
+		return
+	}
+
+	filePath, err := s.filePath(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, ErrObjectNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(w, ErrObjectNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", expiresUnix-time.Now().Unix()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+func (s *LocalStore) signature(key string, expiresAt string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(key + "\n" + expiresAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// filePath maps a key into the store directory, keys escaping it are rejected.
+func (s *LocalStore) filePath(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/utils"
+	"io"
+	"time"
+)
+
+// ImageURLValidity is how long the signed image links in api responses stay usable.
+const ImageURLValidity = 15 * time.Minute
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidKey     = errors.New("invalid object key")
+)
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	UpdatedAt   time.Time
+}
+
+// ObjectStore keeps uploaded files such as product images. Keys are slash separated paths
+// relative to the store, Bucket names the store in the images table.
+type ObjectStore interface {
+	Bucket() string
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a link that lets anyone read the object until it expires.
+	SignedURL(key string, expires time.Duration) (string, error)
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// NewObjectStore uses the firebaseBucket on Google Cloud Storage. Files are only kept on
+// the local disk, which is enough for local development, when storageBackend is set to
+// local, a missing bucket fails the startup instead of quietly writing uploads to disk.
+func NewObjectStore() (ObjectStore, error) {
+	switch backend := utils.GetEnvValue("storageBackend"); backend {
+	case "local":
+		return NewLocalStore(utils.GetEnvValue("storageDir"), utils.GetEnvValue("storageSigningKey"), utils.GetEnvValue("storageBaseUrl"))
+	case "", "gcs":
+		bucket := utils.GetEnvValue("firebaseBucket")
+		if bucket == "" {
+			return nil, errors.New("firebaseBucket is not set, set storageBackend to local to keep uploads on the local disk")
+		}
+		return NewGCSStore(context.Background(), bucket, utils.GetEnvValue("FirebaseConfig"))
+	default:
+		return nil, fmt.Errorf("unknown storageBackend %q, use gcs or local", backend)
+	}
+}
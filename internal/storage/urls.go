@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	// urlRefreshMargin is how long before expiry cached urls are signed again, so every
+	// link handed out stays usable for at least ImageURLValidity minus this margin
+	urlRefreshMargin = 5 * time.Minute
+	signingWorkers   = 8
+	maxCachedURLs    = 10000
+	// defaultPlaceholder is a grey square shown in place of images whose url failed
+	defaultPlaceholder = "data:image/svg+xml;base64,PHN2ZyB4bWxucz0iaHR0cDovL3d3dy53My5vcmcvMjAwMC9zdmciIHZpZXdCb3g9IjAgMCAxIDEiPjxyZWN0IHdpZHRoPSIxIiBoZWlnaHQ9IjEiIGZpbGw9IiNkZGQiLz48L3N2Zz4="
+)
+
+type cachedURL struct {
+	url       string
+	refreshAt time.Time
+}
+
+// ImageURLService signs links to stored images for api responses. Links are signed in
+// parallel and reused until shortly before they expire, an image that can not be signed
+// gets the placeholder instead of failing the whole response.
+type ImageURLService struct {
+	store       ObjectStore
+	placeholder string
+
+	mu    sync.Mutex
+	cache map[string]cachedURL
+}
+
+// NewImageURLService uses imagePlaceholderUrl as placeholder when it is set.
+func NewImageURLService(store ObjectStore) *ImageURLService {
+	placeholder := utils.GetEnvValue("imagePlaceholderUrl")
+	if placeholder == "" {
+		placeholder = defaultPlaceholder
+	}
+	return &ImageURLService{
+		store:       store,
+		placeholder: placeholder,
+		cache:       make(map[string]cachedURL),
+	}
+}
+
+// SignPaths returns a link for every path keyed by path.
+func (s *ImageURLService) SignPaths(paths []string) map[string]string {
+	urls := make(map[string]string, len(paths))
+	var missing []string
+	now := time.Now()
+
+	s.mu.Lock()
+	for _, path := range paths {
+		if _, ok := urls[path]; ok {
+			continue
+		}
+		if cached, ok := s.cache[path]; ok && now.Before(cached.refreshAt) {
+			urls[path] = cached.url
+			continue
+		}
+		urls[path] = s.placeholder
+		missing = append(missing, path)
+	}
+	s.mu.Unlock()
+	if len(missing) == 0 {
+		return urls
+	}
+
+	signed := make([]string, len(missing))
+	jobs := make(chan int)
+	wg := &sync.WaitGroup{}
+	for worker := 0; worker < signingWorkers && worker < len(missing); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				url, err := s.store.SignedURL(missing[i], ImageURLValidity)
+				if err != nil {
+					logrus.Warnf("SignPaths: error in signing url of %s err: %v", missing[i], err)
+					continue
+				}
+				signed[i] = url
+			}
+		}()
+	}
+	for i := range missing {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	refreshAt := now.Add(ImageURLValidity - urlRefreshMargin)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache)+len(missing) > maxCachedURLs {
+		s.evictExpired(now)
+	}
+	for i, path := range missing {
+		if signed[i] == "" {
+			continue
+		}
+		urls[path] = signed[i]
+		s.cache[path] = cachedURL{url: signed[i], refreshAt: refreshAt}
+	}
+	return urls
+}
+
+// Images links every image and its renditions keyed by image id, signing all of them in
+// one batch.
+func (s *ImageURLService) Images(images []models.Images, renditions map[string][]models.ImageRendition) map[string]models.ImageURLs {
+	paths := make([]string, 0, len(images))
+	for _, image := range images {
+		paths = append(paths, image.Path)
+		for _, rendition := range renditions[image.Id] {
+			paths = append(paths, rendition.Path)
+		}
+	}
+	signed := s.SignPaths(paths)
+
+	urls := make(map[string]models.ImageURLs, len(images))
+	for _, image := range images {
+		imageURLs := models.ImageURLs{
+			Id:         image.Id,
+			Width:      image.Width,
+			Height:     image.Height,
+			Original:   signed[image.Path],
+			Renditions: make(map[string]string, len(renditions[image.Id])),
+		}
+		for _, rendition := range renditions[image.Id] {
+			imageURLs.Renditions[rendition.Name] = signed[rendition.Path]
+		}
+		urls[image.Id] = imageURLs
+	}
+	return urls
+}
+
+// evictExpired drops urls due for refresh, and everything when that is not enough to
+// stay under maxCachedURLs. It must be called with mu held.
+func (s *ImageURLService) evictExpired(now time.Time) {
+	for path, cached := range s.cache {
+		if !now.Before(cached.refreshAt) {
+			delete(s.cache, path)
+		}
+	}
+	if len(s.cache) >= maxCachedURLs {
+		s.cache = make(map[string]cachedURL)
+	}
+}
@@ -0,0 +1,236 @@
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+const tokenValidity = 60 * time.Minute
+
+// KeyConfig is one entry of the JwtKeys env value, which holds a json array of these.
+// Keys being rotated out keep only their publicKey so tokens they signed still verify
+// until they expire, while new tokens are signed with the JwtSigningKid key.
+type KeyConfig struct {
+	Kid        string `json:"kid"`
+	PrivateKey string `json:"privateKey"`
+	PublicKey  string `json:"publicKey"`
+}
+
+type Manager struct {
+	issuer     string
+	audience   string
+	signingKey *key
+	keys       map[string]*key
+}
+
+type key struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+}
+
+// NewManager loads the signing keys once at startup. Without configured keys it fails
+// unless JwtEphemeralKey is true, then a key is generated that only suits a single local
+// instance, tokens stop working when it restarts.
+func NewManager() (*Manager, error) {
+	manager := &Manager{
+		issuer:   utils.GetEnvValue("JwtIssuer"),
+		audience: utils.GetEnvValue("JwtAudience"),
+		keys:     make(map[string]*key),
+	}
+	if manager.issuer == "" {
+		manager.issuer = "audiophile"
+	}
+	if manager.audience == "" {
+		manager.audience = "audiophile"
+	}
+
+	rawKeys := utils.GetEnvValue("JwtKeys")
+	if rawKeys == "" {
+		if ephemeral, _ := strconv.ParseBool(utils.GetEnvValue("JwtEphemeralKey")); !ephemeral {
+			return nil, errors.New("JwtKeys is not set, set JwtEphemeralKey to true to sign tokens with a key generated at startup")
+		}
+		logrus.Warn("JwtKeys is not set, signing tokens with an ephemeral key")
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		manager.signingKey = newKey("ephemeral", privateKey, privateKey.Public())
+		manager.keys[manager.signingKey.kid] = manager.signingKey
+		return manager, nil
+	}
+
+	var configs []KeyConfig
+	if err := json.Unmarshal([]byte(rawKeys), &configs); err != nil {
+		return nil, fmt.Errorf("parsing JwtKeys: %w", err)
+	}
+
+	for _, config := range configs {
+		parsedKey, err := parseKey(config)
+		if err != nil {
+			return nil, fmt.Errorf("parsing jwt key %q: %w", config.Kid, err)
+		}
+		manager.keys[parsedKey.kid] = parsedKey
+	}
+
+	signingKid := utils.GetEnvValue("JwtSigningKid")
+	if signingKid == "" && len(configs) > 0 {
+		signingKid = configs[0].Kid
+	}
+	signingKey, ok := manager.keys[signingKid]
+	if !ok || signingKey.privateKey == nil {
+		return nil, fmt.Errorf("jwt signing key %q is not configured with a private key", signingKid)
+	}
+	manager.signingKey = signingKey
+	return manager, nil
+}
+
+func (m *Manager) Generate(userId string, sessionId string, role models.Roles) (string, error) {
+	now := time.Now()
+	claims := &models.Claims{
+		UserId:    userId,
+		SessionId: sessionId,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   userId,
+			Audience:  jwt.ClaimStrings{m.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenValidity)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token := jwt.NewWithClaims(m.signingKey.method, claims)
+	token.Header["kid"] = m.signingKey.kid
+	return token.SignedString(m.signingKey.privateKey)
+}
+
+// Parse verifies the signature against the key named by the kid header along with
+// the expiry, issuer and audience of the token.
+func (m *Manager) Parse(tokenString string) (*models.Claims, error) {
+	claims := &models.Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}))
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		verificationKey, ok := m.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != verificationKey.method.Alg() {
+			return nil, errors.New("signing method does not match the key")
+		}
+		return verificationKey.publicKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !claims.VerifyIssuer(m.issuer, true) {
+		return nil, errors.New("token has an unexpected issuer")
+	}
+	if !claims.VerifyAudience(m.audience, true) {
+		return nil, errors.New("token has an unexpected audience")
+	}
+	return claims, nil
+}
+
+// JWKS returns the public part of every configured key, so tokens signed by keys being
+// rotated in or out can be verified by other services.
+func (m *Manager) JWKS() models.JSONWebKeySet {
+	keySet := models.JSONWebKeySet{Keys: []models.JSONWebKey{}}
+	for _, configuredKey := range m.keys {
+		webKey := models.JSONWebKey{
+			Kid: configuredKey.kid,
+			Use: "sig",
+			Alg: configuredKey.method.Alg(),
+		}
+		switch publicKey := configuredKey.publicKey.(type) {
+		case *rsa.PublicKey:
+			webKey.Kty = "RSA"
+			webKey.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			webKey.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			webKey.Kty = "OKP"
+			webKey.Crv = "Ed25519"
+			webKey.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		keySet.Keys = append(keySet.Keys, webKey)
+	}
+	return keySet
+}
+
+func newKey(kid string, privateKey crypto.Signer, publicKey crypto.PublicKey) *key {
+	parsedKey := &key{
+		kid:        kid,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+	}
+	if _, ok := publicKey.(*rsa.PublicKey); ok {
+		parsedKey.method = jwt.SigningMethodRS256
+	} else {
+		parsedKey.method = jwt.SigningMethodEdDSA
+	}
+	return parsedKey
+}
+
+func parseKey(config KeyConfig) (*key, error) {
+	if config.Kid == "" {
+		return nil, errors.New("kid is required")
+	}
+
+	if config.PrivateKey != "" {
+		block, _ := pem.Decode([]byte(config.PrivateKey))
+		if block == nil {
+			return nil, errors.New("private key is not pem encoded")
+		}
+
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+
+		switch privateKey := parsed.(type) {
+		case *rsa.PrivateKey:
+			return newKey(config.Kid, privateKey, privateKey.Public()), nil
+		case ed25519.PrivateKey:
+			return newKey(config.Kid, privateKey, privateKey.Public()), nil
+		default:
+			return nil, errors.New("only RSA and Ed25519 keys are supported")
+		}
+	}
+
+	block, _ := pem.Decode([]byte(config.PublicKey))
+	if block == nil {
+		return nil, errors.New("either a pem encoded private or public key is required")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch publicKey := parsed.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return newKey(config.Kid, nil, publicKey), nil
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"github.com/Shresth92/audiophile/api/middlewares"
 	"github.com/Shresth92/audiophile/api/routes"
 	"github.com/Shresth92/audiophile/internal"
-	"github.com/Shresth92/audiophile/models"
 	"github.com/Shresth92/audiophile/services"
 	"github.com/Shresth92/audiophile/utils"
 	"github.com/sirupsen/logrus"
@@ -19,6 +18,9 @@ const (
 	readTimeout       = 5 * time.Minute
 	readHeaderTimeout = 30 * time.Second
 	writeTimeout      = 5 * time.Minute
+
+	defaultImageCleanupInterval = 6 * time.Hour
+	jobRecoveryInterval         = 5 * time.Minute
 )
 
 func startServer(
@@ -39,7 +41,6 @@ func startServer(
 	lifecycle.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			db.MigrateUpDb()
-			models.FirebaseClient, _ = utils.GetFirebaseClient()
 			go func(srv *http.Server) {
 				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 					logrus.Error(err)
@@ -59,6 +60,90 @@ func startServer(
 	})
 }
 
+// startImageCleanup deletes orphaned images every imageCleanupInterval, which defaults to
+// six hours.
+func startImageCleanup(adminService services.AdminServices, lifecycle fx.Lifecycle) {
+	interval, err := time.ParseDuration(utils.GetEnvValue("imageCleanupInterval"))
+	if err != nil || interval <= 0 {
+		interval = defaultImageCleanupInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go func() {
+				ticker := time.NewTicker(interval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						deleted, err := adminService.CleanupOrphanImages(ctx)
+						if err != nil && ctx.Err() == nil {
+							logrus.Errorf("startImageCleanup: error in cleaning up images err: %v", err)
+						}
+						if deleted > 0 {
+							logrus.Infof("startImageCleanup: deleted %d orphaned images", deleted)
+						}
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+}
+
+// recoverBackgroundJobs fails the jobs that timed out, like those an instance of the app
+// left unfinished when it stopped. It runs after the migrations of startServer and then
+// every jobRecoveryInterval.
+func recoverBackgroundJobs(userService services.UserServices, adminService services.AdminServices, lifecycle fx.Lifecycle) {
+	sweep := func() {
+		exports, err := userService.RecoverDataExports()
+		if err != nil {
+			logrus.Errorf("recoverBackgroundJobs: error in recovering data exports err: %v", err)
+		}
+		if exports > 0 {
+			logrus.Infof("recoverBackgroundJobs: failed %d timed out data exports", exports)
+		}
+		jobs, err := adminService.RecoverCatalogJobs()
+		if err != nil {
+			logrus.Errorf("recoverBackgroundJobs: error in recovering catalog jobs err: %v", err)
+		}
+		if jobs > 0 {
+			logrus.Infof("recoverBackgroundJobs: failed %d timed out catalog jobs", jobs)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	lifecycle.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			sweep()
+			go func() {
+				ticker := time.NewTicker(jobRecoveryInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						sweep()
+					}
+				}
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+}
+
 func main() {
 	var CommonModules = fx.Options(
 		controller.Module,
@@ -67,9 +152,9 @@ func main() {
 		internal.Module,
 		middlewares.Module,
 	)
-	app := fx.New(CommonModules, fx.Invoke(startServer))
+	app := fx.New(CommonModules, fx.Invoke(startServer, recoverBackgroundJobs, startImageCleanup))
 	if app.Err() != nil {
-		logrus.Error("failed to start the app")
+		logrus.Errorf("failed to start the app err: %v", app.Err())
 	}
 	app.Run()
 }
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+type AttributeType string
+
+const (
+	AttributeText    AttributeType = "text"
+	AttributeNumber  AttributeType = "number"
+	AttributeBoolean AttributeType = "boolean"
+	// AttributeList holds several text values, like the codecs a headphone supports
+	AttributeList AttributeType = "list"
+)
+
+type (
+	// Attribute is a specification admins define per category, products of the category
+	// store their values for it in ProductAttributeValue.
+	Attribute struct {
+		Id         string        `json:"id" gorm:"column:id;primaryKey"`
+		CategoryId string        `json:"categoryId" gorm:"column:category_id;index:unique_category_attribute,unique,where:archived_at is null"`
+		Key        string        `json:"key" gorm:"column:key;index:unique_category_attribute,unique,where:archived_at is null"`
+		Name       string        `json:"name" gorm:"column:name"`
+		Type       AttributeType `json:"type" gorm:"column:type;type:attribute_type"`
+		Unit       string        `json:"unit" gorm:"column:unit"`
+		CreatedAt  time.Time     `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt  time.Time     `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt time.Time     `json:"archivedAt" gorm:"column:archived_at;default:null"`
+	}
+
+	// ProductAttributeValue keeps every value as text for equality filters, numbers are
+	// also kept in NumberValue for range filters. List attributes have one row per item.
+	ProductAttributeValue struct {
+		Id          string   `json:"id" gorm:"column:id;primaryKey"`
+		ProductId   string   `json:"productId" gorm:"column:product_id;index"`
+		AttributeId string   `json:"attributeId" gorm:"column:attribute_id;index"`
+		TextValue   string   `json:"textValue" gorm:"column:text_value"`
+		NumberValue *float64 `json:"numberValue" gorm:"column:number_value"`
+	}
+
+	AttributeBody struct {
+		Key  string        `json:"key" binding:"required,max=64"`
+		Name string        `json:"name" binding:"required,max=255"`
+		Type AttributeType `json:"type" binding:"required,oneof=text number boolean list"`
+		Unit string        `json:"unit" binding:"max=32"`
+	}
+
+	// ProductAttributes maps attribute keys of the product category to their values, a
+	// string, number, boolean or list of strings depending on the attribute type.
+	ProductAttributes map[string]interface{}
+
+	ProductAttribute struct {
+		Key   string        `json:"key"`
+		Name  string        `json:"name"`
+		Type  AttributeType `json:"type"`
+		Unit  string        `json:"unit,omitempty"`
+		Value interface{}   `json:"value"`
+	}
+
+	// AttributeFilter is one attr.<key> filter of the product search, Min and Max only
+	// apply to number attributes.
+	AttributeFilter struct {
+		Key   string
+		Value string
+		Min   *float64
+		Max   *float64
+	}
+)
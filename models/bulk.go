@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+type CatalogJobKind string
+
+const (
+	CatalogImport CatalogJobKind = "import"
+	CatalogExport CatalogJobKind = "export"
+)
+
+type CatalogFormat string
+
+const (
+	CatalogCSV       CatalogFormat = "csv"
+	CatalogJSONLines CatalogFormat = "jsonl"
+)
+
+type (
+	// CatalogJob imports products from an uploaded file or exports the catalog into one.
+	// Imports keep the uploaded file in Input until they ran, exports their file in Output.
+	CatalogJob struct {
+		Id          string           `json:"id" gorm:"column:id;primaryKey"`
+		AdminId     string           `json:"adminId" gorm:"column:admin_id;index"`
+		Kind        CatalogJobKind   `json:"kind" gorm:"column:kind;type:catalog_job_kind"`
+		Format      CatalogFormat    `json:"format" gorm:"column:format"`
+		DryRun      bool             `json:"dryRun" gorm:"column:dry_run;default:false"`
+		Status      ExportStatus     `json:"status" gorm:"column:status;type:export_status"`
+		Input       []byte           `json:"-" gorm:"column:input"`
+		Output      []byte           `json:"-" gorm:"column:output"`
+		TotalRows   int              `json:"totalRows" gorm:"column:total_rows;default:0"`
+		FailedRows  int              `json:"failedRows" gorm:"column:failed_rows;default:0"`
+		Products    int              `json:"products" gorm:"column:products;default:0"`
+		Variants    int              `json:"variants" gorm:"column:variants;default:0"`
+		RowErrors   []ImportRowError `json:"rowErrors" gorm:"column:row_errors;type:jsonb;serializer:json"`
+		Error       string           `json:"error,omitempty" gorm:"column:error"`
+		CreatedAt   time.Time        `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		CompletedAt time.Time        `json:"completedAt" gorm:"column:completed_at;default:null"`
+		ExpiresAt   time.Time        `json:"expiresAt" gorm:"column:expires_at"`
+	}
+
+	// ImportRowError explains why the row starting at Line of the imported file was skipped.
+	ImportRowError struct {
+		Line    int    `json:"line"`
+		Message string `json:"message"`
+	}
+
+	// CatalogRow is one variant in an import or export file. Rows sharing the brand and
+	// model name describe variants of the same product, whose details are taken from the
+	// first of them. Brand and Category hold a name or slug.
+	CatalogRow struct {
+		Line        int               `json:"-"`
+		ProductName string            `json:"productName"`
+		ModelName   string            `json:"modelName"`
+		Brand       string            `json:"brand"`
+		Category    string            `json:"category"`
+		Return      int               `json:"return"`
+		Warranty    int               `json:"warranty"`
+		Wireless    bool              `json:"wireless"`
+		Colour      string            `json:"colour"`
+		Price       int               `json:"price"`
+		Stock       int               `json:"stock"`
+		ImageIds    []string          `json:"imageIds,omitempty"`
+		Attributes  ProductAttributes `json:"attributes,omitempty"`
+	}
+)
@@ -0,0 +1,33 @@
+package models
+
+type (
+	ComparedProduct struct {
+		ProductId    string `json:"productId"`
+		VariantId    string `json:"variantId,omitempty"`
+		ProductName  string `json:"productName"`
+		ModelName    string `json:"modelName"`
+		BrandName    string `json:"brandName"`
+		CategoryName string `json:"categoryName"`
+		Colour       string `json:"colour,omitempty"`
+	}
+
+	PriceRange struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+
+	// ComparisonRow holds one specification of every compared product, Values is aligned
+	// with ProductComparison.Products and has nil where a product lacks the attribute.
+	ComparisonRow struct {
+		Key     string        `json:"key"`
+		Name    string        `json:"name"`
+		Unit    string        `json:"unit,omitempty"`
+		Values  []interface{} `json:"values"`
+		Differs bool          `json:"differs"`
+	}
+
+	ProductComparison struct {
+		Products []ComparedProduct `json:"products"`
+		Rows     []ComparisonRow   `json:"rows"`
+	}
+)
@@ -0,0 +1,27 @@
+package models
+
+import "errors"
+
+var (
+	ErrInvalidToken     = errors.New("token is invalid or expired")
+	ErrIdentityConflict = errors.New("an account with this email already exists")
+	ErrInvalidTotpCode  = errors.New("two factor code is invalid")
+	ErrEmailTaken       = errors.New("email is already in use")
+	ErrInvalidAttribute = errors.New("invalid product attribute")
+	ErrAttributeTaken   = errors.New("category already has an attribute with this key")
+	ErrProductNotFound  = errors.New("product not found")
+	ErrSlugTaken        = errors.New("slug is already in use")
+	ErrInvalidParent    = errors.New("parent category does not exist or is the category itself or one of its subcategories")
+	ErrNotVerifiedBuyer = errors.New("only buyers who received this variant can review it")
+	ErrReviewExists     = errors.New("variant is already reviewed")
+	ErrInvalidPhotos    = errors.New("photos must be your own uploads and not used by another review")
+	ErrTooManyPhotos    = errors.New("too many photos are waiting to be added to a review")
+	ErrNotProductBuyer  = errors.New("only buyers who received this product can answer questions about it")
+	ErrInvalidGallery   = errors.New("image ids must list every image of the gallery exactly once")
+	ErrImageInUse       = errors.New("image is attached to a variant or review")
+	ErrInvalidBulkEdit  = errors.New("invalid bulk update")
+	ErrNotPublishable   = errors.New("a product needs a variant with an image before it can be published")
+	ErrInvalidSale      = errors.New("sale price must be below the price and the sale must end after it starts")
+	ErrVariantNotFound  = errors.New("variant is not for sale")
+	ErrJobStopped       = errors.New("job is no longer running")
+)
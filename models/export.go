@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+type ExportStatus string
+
+const (
+	ExportPending   ExportStatus = "pending"
+	ExportRunning   ExportStatus = "running"
+	ExportCompleted ExportStatus = "completed"
+	ExportFailed    ExportStatus = "failed"
+)
+
+type (
+	DataExport struct {
+		Id          string       `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId      string       `json:"userId" gorm:"column:user_id;index"`
+		User        Users        `json:"-" gorm:"foreignKey:UserId"`
+		Status      ExportStatus `json:"status" gorm:"column:status;type:export_status"`
+		Archive     []byte       `json:"-" gorm:"column:archive"`
+		Error       string       `json:"error,omitempty" gorm:"column:error"`
+		CreatedAt   time.Time    `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		CompletedAt time.Time    `json:"completedAt" gorm:"column:completed_at;default:null"`
+		ExpiresAt   time.Time    `json:"expiresAt" gorm:"column:expires_at"`
+	}
+
+	UserDataExport struct {
+		Profile   Profile    `json:"profile"`
+		Addresses []Address  `json:"addresses"`
+		Sessions  []Session  `json:"sessions"`
+		Cart      []UserCart `json:"cart"`
+		Orders    []Orders   `json:"orders"`
+		Reviews   []Review   `json:"reviews"`
+		Questions []Question `json:"questions"`
+		Answers   []Answer   `json:"answers"`
+	}
+)
@@ -11,4 +11,19 @@ type (
 		Role      Roles  `json:"role"`
 		jwt.RegisteredClaims
 	}
+
+	JSONWebKey struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n,omitempty"`
+		E   string `json:"e,omitempty"`
+		Crv string `json:"crv,omitempty"`
+		X   string `json:"x,omitempty"`
+	}
+
+	JSONWebKeySet struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
 )
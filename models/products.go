@@ -4,49 +4,90 @@ import (
 	"time"
 )
 
+type ProductStatus string
+
+const (
+	ProductDraft     ProductStatus = "draft"
+	ProductPublished ProductStatus = "published"
+	ProductArchived  ProductStatus = "archived"
+)
+
+type AdjustmentMode string
+
+const (
+	AdjustSet     AdjustmentMode = "set"
+	AdjustAmount  AdjustmentMode = "amount"
+	AdjustPercent AdjustmentMode = "percent"
+)
+
 type (
+	// Category is a node of the category tree, ParentId is nil for top level categories.
+	// On updates an empty ParentId moves the category to the top level.
 	Category struct {
-		Id           string    `json:"id" gorm:"column:id;index"`
+		Id           string    `json:"id" gorm:"column:id;primaryKey;index"`
 		CategoryName string    `json:"categoryName" gorm:"column:category_name"`
+		ParentId     *string   `json:"parentId" gorm:"column:parent_id;index"`
+		Slug         string    `json:"slug" gorm:"column:slug"`
 		CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
 		UpdatedAt    time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
 		ArchivedAt   time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
+	CategoryNode struct {
+		Id           string         `json:"id"`
+		CategoryName string         `json:"categoryName"`
+		Slug         string         `json:"slug"`
+		Children     []CategoryNode `json:"children"`
+	}
+
+	Breadcrumb struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+
 	Brand struct {
 		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
 		BrandName  string    `json:"brandName" gorm:"column:brand_name"`
+		Slug       string    `json:"slug" gorm:"column:slug"`
 		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
 		UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
 		ArchivedAt time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
+	// Product is created as a draft and only shown to shoppers once it is published.
 	Product struct {
-		Id          string    `json:"id" gorm:"column:id;primaryKey;index"`
-		ProductName string    `json:"productName" gorm:"column:product_name"`
-		ModelName   string    `json:"modelName" gorm:"column:model_name"`
-		BrandId     string    `json:"brandId" gorm:"column:brand_id"`
-		Brand       Brand     `gorm:"foreignKey:BrandId"`
-		CategoryId  string    `json:"categoryId"`
-		Category    Category  `gorm:"column:category_id;foreignKey:CategoryId"`
-		Return      int       `json:"return" gorm:"column:return"`
-		Warranty    int       `json:"warranty"  gorm:"column:warranty"`
-		Wireless    bool      `json:"wireless"  gorm:"column:wireless"`
-		CreatedAt   time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
-		UpdatedAt   time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
-		ArchivedAt  time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+		Id          string        `json:"id" gorm:"column:id;primaryKey;index"`
+		ProductName string        `json:"productName" gorm:"column:product_name"`
+		ModelName   string        `json:"modelName" gorm:"column:model_name"`
+		BrandId     string        `json:"brandId" gorm:"column:brand_id"`
+		Brand       Brand         `gorm:"foreignKey:BrandId"`
+		CategoryId  string        `json:"categoryId"`
+		Category    Category      `gorm:"column:category_id;foreignKey:CategoryId"`
+		Return      int           `json:"return" gorm:"column:return"`
+		Warranty    int           `json:"warranty"  gorm:"column:warranty"`
+		Wireless    bool          `json:"wireless"  gorm:"column:wireless"`
+		Status      ProductStatus `json:"status" gorm:"column:status;type:product_status;default:draft"`
+		CreatedAt   time.Time     `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt   time.Time     `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt  time.Time     `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
+	// Variants are sold at SalePrice instead of Price between SaleStartsAt and SaleEndsAt,
+	// either of which may be zero to leave the sale open ended.
 	Variants struct {
-		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
-		ProductId  string    `json:"productId"`
-		Product    Product   `gorm:"column:product_id;foreignKey:ProductId"`
-		Colour     string    `json:"colour" gorm:"column:colour"`
-		Price      int       `json:"price" gorm:"column:price"`
-		Stock      int       `json:"stock" gorm:"column:stock"`
-		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
-		UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
-		ArchivedAt time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+		Id           string    `json:"id" gorm:"column:id;primaryKey;index"`
+		ProductId    string    `json:"productId"`
+		Product      Product   `gorm:"column:product_id;foreignKey:ProductId"`
+		Colour       string    `json:"colour" gorm:"column:colour"`
+		Price        int       `json:"price" gorm:"column:price"`
+		SalePrice    *int      `json:"salePrice" gorm:"column:sale_price"`
+		SaleStartsAt time.Time `json:"saleStartsAt" gorm:"column:sale_starts_at;default:null"`
+		SaleEndsAt   time.Time `json:"saleEndsAt" gorm:"column:sale_ends_at;default:null"`
+		Stock        int       `json:"stock" gorm:"column:stock"`
+		CreatedAt    time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt    time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt   time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
 	Offer struct {
@@ -62,54 +103,142 @@ type (
 		ArchivedAt  time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
+	// PublicOffer is an offer as guests see it, the coupon code is only shown to logged in
+	// users.
+	PublicOffer struct {
+		Id          string    `json:"id" gorm:"column:id"`
+		OfferName   string    `json:"offerName" gorm:"column:offer_name"`
+		Percent     int       `json:"percent" gorm:"column:percent"`
+		MaxDiscount int       `json:"maxDiscount" gorm:"column:max_discount"`
+		Validity    time.Time `json:"validity" gorm:"column:validity"`
+		Description string    `json:"description" gorm:"column:description"`
+	}
+
+	// Images is an uploaded original, Width and Height are zero for images uploaded before
+	// uploads were processed. UploadedBy is the shopper a review photo belongs to, it is
+	// empty for catalog images.
 	Images struct {
-		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
-		BucketName string    `json:"bucketName" gorm:"column:bucket_name"`
-		Path       string    `json:"path" gorm:"column:path"`
-		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
-		UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
-		ArchivedAt time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+		Id          string    `json:"id" gorm:"column:id;primaryKey;index"`
+		UploadedBy  string    `json:"-" gorm:"column:uploaded_by;index;default:''"`
+		BucketName  string    `json:"bucketName" gorm:"column:bucket_name"`
+		Path        string    `json:"path" gorm:"column:path"`
+		ContentType string    `json:"contentType" gorm:"column:content_type"`
+		Width       int       `json:"width" gorm:"column:width"`
+		Height      int       `json:"height" gorm:"column:height"`
+		Size        int64     `json:"size" gorm:"column:size"`
+		CreatedAt   time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt   time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt  time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+	}
+
+	ImageRendition struct {
+		Id          string `json:"id" gorm:"column:id;primaryKey"`
+		ImageId     string `json:"imageId" gorm:"column:image_id;index"`
+		Name        string `json:"name" gorm:"column:name"`
+		Path        string `json:"path" gorm:"column:path"`
+		ContentType string `json:"contentType" gorm:"column:content_type"`
+		Width       int    `json:"width" gorm:"column:width"`
+		Height      int    `json:"height" gorm:"column:height"`
+	}
+
+	// ImageURLs links to an image and its renditions by name, like thumbnail or large.
+	ImageURLs struct {
+		Id         string            `json:"id"`
+		Width      int               `json:"width"`
+		Height     int               `json:"height"`
+		Original   string            `json:"original"`
+		Renditions map[string]string `json:"renditions"`
+		AltText    string            `json:"altText,omitempty"`
+	}
+
+	GalleryImage struct {
+		ImageURLs
+		Position  int  `json:"position"`
+		IsPrimary bool `json:"isPrimary"`
+	}
+
+	// OrphanImage is an uploaded image that is attached to no variant or review.
+	OrphanImage struct {
+		ImageURLs
+		Size      int64     `json:"size"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	// GalleryImageIdsBody lists images to add to a gallery, or when reordering every image
+	// of the gallery once in the order to show them.
+	GalleryImageIdsBody struct {
+		ImageIds []string `json:"imageIds" binding:"required,min=1"`
+	}
+
+	// GalleryImageBody changes the fields that are set, making an image primary takes the
+	// flag away from the previous one.
+	GalleryImageBody struct {
+		AltText   *string `json:"altText" binding:"omitempty,max=255"`
+		IsPrimary *bool   `json:"isPrimary"`
 	}
 
+	// VariantImages attaches an image to the gallery of a variant. Galleries are shown with
+	// the primary image first and the rest by Position.
 	VariantImages struct {
 		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
 		ImageId    string    `json:"imageId"`
 		Images     Images    `gorm:"column:image_id;foreignKey:ImageId"`
 		VariantId  string    `json:"variantId"`
 		Variant    Variants  `gorm:"column:variant_id;foreignKey:VariantId"`
+		Position   int       `json:"position" gorm:"column:position;default:0"`
+		IsPrimary  bool      `json:"isPrimary" gorm:"column:is_primary;default:false"`
+		AltText    string    `json:"altText" gorm:"column:alt_text"`
 		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
 		UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
 		ArchivedAt time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
 	}
 
 	AllProducts struct {
-		VariantID    string `json:"variantId"`
-		ProductName  string `json:"productName"`
-		ModelName    string `json:"modelName"`
-		BrandName    string `json:"brandName"`
-		CategoryName string `json:"categoryName"`
-		Return       int    `json:"return"`
-		Warranty     int    `json:"warranty"`
-		Wireless     bool   `json:"wireless"`
-		Colour       string `json:"colour"`
-		Price        int    `json:"price"`
-		Stock        int    `json:"stock"`
-		BucketName   string `json:"bucketName"`
-		Path         string `json:"path"`
+		ProductID      string        `json:"productId"`
+		ImageID        string        `json:"imageId"`
+		VariantID      string        `json:"variantId"`
+		ProductName    string        `json:"productName"`
+		ModelName      string        `json:"modelName"`
+		BrandName      string        `json:"brandName"`
+		BrandSlug      string        `json:"brandSlug"`
+		CategoryID     string        `json:"categoryId"`
+		CategoryName   string        `json:"categoryName"`
+		Return         int           `json:"return"`
+		Warranty       int           `json:"warranty"`
+		Wireless       bool          `json:"wireless"`
+		Status         ProductStatus `json:"status"`
+		Colour         string        `json:"colour"`
+		Price          int           `json:"price"`
+		CompareAtPrice int           `json:"compareAtPrice"`
+		Stock          int           `json:"stock"`
+		BucketName     string        `json:"bucketName"`
+		Path           string        `json:"path"`
+		Width          int           `json:"width"`
+		Height         int           `json:"height"`
+		AltText        string        `json:"altText"`
 	}
 
 	ProductBody struct {
-		ProductName string   `json:"productName"`
-		ModelName   string   `json:"modelName"`
-		BrandID     string   `json:"brandId"`
-		CategoryID  string   `json:"categoryId"`
-		Return      int      `json:"return"`
-		Warranty    int      `json:"warranty"`
-		Wireless    bool     `json:"wireless"`
-		Colour      string   `json:"colour"`
-		Price       int      `json:"price"`
-		Stock       int      `json:"stock"`
-		ImageIds    []string `json:"imageIds"`
+		ProductName string            `json:"productName"`
+		ModelName   string            `json:"modelName"`
+		BrandID     string            `json:"brandId"`
+		CategoryID  string            `json:"categoryId"`
+		Return      int               `json:"return"`
+		Warranty    int               `json:"warranty"`
+		Wireless    bool              `json:"wireless"`
+		Colour      string            `json:"colour"`
+		Price       int               `json:"price"`
+		Stock       int               `json:"stock"`
+		ImageIds    []string          `json:"imageIds"`
+		Attributes  ProductAttributes `json:"attributes"`
+	}
+
+	// VariantSaleBody puts a variant on sale, StartsAt defaults to now and a zero EndsAt
+	// keeps the sale running until it is removed.
+	VariantSaleBody struct {
+		SalePrice int       `json:"salePrice" binding:"required,min=1"`
+		StartsAt  time.Time `json:"startsAt"`
+		EndsAt    time.Time `json:"endsAt"`
 	}
 
 	VariantBody struct {
@@ -119,18 +248,80 @@ type (
 		ImageIds []string `json:"imageIds"`
 	}
 
-	Products struct {
-		Id           string   `json:"variantId"`
-		ProductName  string   `json:"productName"`
-		ModelName    string   `json:"modelName"`
-		BrandName    string   `json:"brandName"`
-		CategoryName string   `json:"categoryName"`
-		Return       int      `json:"return"`
-		Warranty     int      `json:"warranty"`
-		Wireless     bool     `json:"wireless"`
-		Colour       string   `json:"colour"`
-		Price        int      `json:"price"`
-		Stock        int      `json:"stock"`
-		ImageLinks   []string `json:"imageLinks"`
+	// BulkVariantUpdateBody adjusts the price and stock of every active variant matching all
+	// the filters given. A preview reports the changes without saving them.
+	BulkVariantUpdateBody struct {
+		BrandIds    []string         `json:"brandIds"`
+		CategoryIds []string         `json:"categoryIds"`
+		ProductIds  []string         `json:"productIds"`
+		Price       *PriceAdjustment `json:"price"`
+		Stock       *StockAdjustment `json:"stock"`
+		Preview     bool             `json:"preview"`
+	}
+
+	// PriceAdjustment sets the price to Value, adds Value to it or changes it by Value
+	// percent, prices are rounded to whole units.
+	PriceAdjustment struct {
+		Mode  AdjustmentMode `json:"mode" binding:"required,oneof=set amount percent"`
+		Value float64        `json:"value"`
+	}
+
+	StockAdjustment struct {
+		Mode  AdjustmentMode `json:"mode" binding:"required,oneof=set amount"`
+		Value int            `json:"value"`
+	}
+
+	BulkVariantChange struct {
+		VariantId   string `json:"variantId"`
+		ProductId   string `json:"productId"`
+		ProductName string `json:"productName"`
+		Colour      string `json:"colour"`
+		OldPrice    int    `json:"oldPrice"`
+		NewPrice    int    `json:"newPrice"`
+		OldStock    int    `json:"oldStock"`
+		NewStock    int    `json:"newStock"`
+	}
+
+	BulkVariantUpdateResult struct {
+		Preview  bool                `json:"preview"`
+		Variants int                 `json:"variants"`
+		Changes  []BulkVariantChange `json:"changes"`
+	}
+
+	// CatalogVariant keeps ImageLinks to the originals for older clients, Images also
+	// links the renditions. Price is what the variant sells for right now, CompareAtPrice
+	// is the regular price shown crossed out while it is on sale.
+	CatalogVariant struct {
+		Id             string      `json:"variantId"`
+		Colour         string      `json:"colour"`
+		Price          int         `json:"price"`
+		CompareAtPrice int         `json:"compareAtPrice,omitempty"`
+		Stock          int         `json:"stock"`
+		ImageLinks     []string    `json:"imageLinks"`
+		Images         []ImageURLs `json:"images"`
+	}
+
+	// CatalogProduct is a product as shoppers browse it, with its price range and stock
+	// summed up over the variants listed under it.
+	CatalogProduct struct {
+		Id           string             `json:"productId"`
+		ProductName  string             `json:"productName"`
+		ModelName    string             `json:"modelName"`
+		BrandName    string             `json:"brandName"`
+		BrandSlug    string             `json:"brandSlug"`
+		CategoryId   string             `json:"categoryId"`
+		CategoryName string             `json:"categoryName"`
+		Breadcrumbs  []Breadcrumb       `json:"breadcrumbs"`
+		Return       int                `json:"return"`
+		Warranty     int                `json:"warranty"`
+		Wireless     bool               `json:"wireless"`
+		Status       ProductStatus      `json:"status"`
+		MinPrice     int                `json:"minPrice"`
+		MaxPrice     int                `json:"maxPrice"`
+		TotalStock   int                `json:"totalStock"`
+		Rating       ReviewSummary      `json:"rating"`
+		Variants     []CatalogVariant   `json:"variants"`
+		Attributes   []ProductAttribute `json:"attributes,omitempty"`
+		Questions    *Response          `json:"questions,omitempty"`
 	}
 )
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+type (
+	// Question is asked by a user about a product, it is shown until an admin hides it.
+	Question struct {
+		Id         string    `json:"id" gorm:"column:id;primaryKey"`
+		ProductId  string    `json:"productId" gorm:"column:product_id;index"`
+		UserId     string    `json:"userId" gorm:"column:user_id;index"`
+		Body       string    `json:"body" gorm:"column:body"`
+		Hidden     bool      `json:"hidden" gorm:"column:hidden;default:false"`
+		CreatedAt  time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt  time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+	}
+
+	// Answer is written by an admin or by a buyer who received the product, which of the two
+	// is kept so the answer can be labelled.
+	Answer struct {
+		Id            string    `json:"id" gorm:"column:id;primaryKey"`
+		QuestionId    string    `json:"questionId" gorm:"column:question_id;index"`
+		UserId        string    `json:"userId" gorm:"column:user_id;index"`
+		Body          string    `json:"body" gorm:"column:body"`
+		ByAdmin       bool      `json:"byAdmin" gorm:"column:by_admin"`
+		VerifiedBuyer bool      `json:"verifiedBuyer" gorm:"column:verified_buyer"`
+		Hidden        bool      `json:"hidden" gorm:"column:hidden;default:false"`
+		CreatedAt     time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt     time.Time `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt    time.Time `json:"archivedAt" gorm:"column:archived_at;default:null"`
+	}
+
+	QuestionBody struct {
+		Body string `json:"body" binding:"required,max=1000"`
+	}
+
+	AnswerBody struct {
+		Body string `json:"body" binding:"required,max=5000"`
+	}
+
+	VisibilityBody struct {
+		Hidden *bool `json:"hidden" binding:"required"`
+	}
+
+	ProductAnswer struct {
+		Id            string    `json:"id"`
+		QuestionId    string    `json:"-"`
+		Author        string    `json:"author"`
+		Body          string    `json:"body"`
+		ByAdmin       bool      `json:"byAdmin"`
+		VerifiedBuyer bool      `json:"verifiedBuyer"`
+		Hidden        bool      `json:"hidden,omitempty"`
+		CreatedAt     time.Time `json:"createdAt"`
+	}
+
+	ProductQuestion struct {
+		Id        string          `json:"id"`
+		ProductId string          `json:"productId"`
+		Author    string          `json:"author"`
+		Body      string          `json:"body"`
+		Hidden    bool            `json:"hidden,omitempty"`
+		CreatedAt time.Time       `json:"createdAt"`
+		Answers   []ProductAnswer `json:"answers" gorm:"-"`
+	}
+)
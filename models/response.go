@@ -1,6 +1,8 @@
 package models
 
 type Response struct {
-	TotalRows int64
-	Rows      interface{}
+	TotalRows  int64
+	Rows       interface{}
+	NextCursor string `json:",omitempty"`
+	PrevCursor string `json:",omitempty"`
 }
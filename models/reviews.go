@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+type ReviewStatus string
+
+const (
+	// ReviewPending reviews wait for an admin before they are shown in the catalog
+	ReviewPending  ReviewStatus = "pending"
+	ReviewApproved ReviewStatus = "approved"
+	ReviewHidden   ReviewStatus = "hidden"
+)
+
+type (
+	// Review is written by a user for a variant they received, one per user and variant.
+	Review struct {
+		Id         string       `json:"id" gorm:"column:id;primaryKey"`
+		UserId     string       `json:"userId" gorm:"column:user_id;index:unique_user_variant_review,unique,where:archived_at is null"`
+		ProductId  string       `json:"productId" gorm:"column:product_id;index"`
+		VariantId  string       `json:"variantId" gorm:"column:variant_id;index:unique_user_variant_review,unique,where:archived_at is null"`
+		Rating     int          `json:"rating" gorm:"column:rating"`
+		Title      string       `json:"title" gorm:"column:title"`
+		Body       string       `json:"body" gorm:"column:body"`
+		Status     ReviewStatus `json:"status" gorm:"column:status;type:review_status;default:pending"`
+		CreatedAt  time.Time    `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt  time.Time    `json:"updatedAt" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt time.Time    `json:"archivedAt" gorm:"column:archived_at;default:null"`
+	}
+
+	ReviewImage struct {
+		Id       string `json:"id" gorm:"column:id;primaryKey"`
+		ReviewId string `json:"reviewId" gorm:"column:review_id;index"`
+		ImageId  string `json:"imageId" gorm:"column:image_id"`
+		Images   Images `json:"-" gorm:"foreignKey:ImageId"`
+	}
+
+	// ReviewVote marks a review as helpful to a user, a user votes for a review at most once.
+	ReviewVote struct {
+		ReviewId  string    `json:"reviewId" gorm:"column:review_id;primaryKey"`
+		UserId    string    `json:"userId" gorm:"column:user_id;primaryKey"`
+		CreatedAt time.Time `json:"createdAt" gorm:"column:created_at;default:current_timestamp"`
+	}
+
+	ReviewBody struct {
+		VariantId string   `json:"variantId" binding:"required"`
+		Rating    int      `json:"rating" binding:"required,min=1,max=5"`
+		Title     string   `json:"title" binding:"required,max=255"`
+		Body      string   `json:"body" binding:"max=5000"`
+		ImageIds  []string `json:"imageIds" binding:"max=5"`
+	}
+
+	ModerationBody struct {
+		Status ReviewStatus `json:"status" binding:"required,oneof=approved hidden"`
+	}
+
+	ProductReview struct {
+		Id           string       `json:"id"`
+		ProductId    string       `json:"productId"`
+		VariantId    string       `json:"variantId"`
+		Colour       string       `json:"colour"`
+		Author       string       `json:"author"`
+		Rating       int          `json:"rating"`
+		Title        string       `json:"title"`
+		Body         string       `json:"body"`
+		Status       ReviewStatus `json:"status"`
+		HelpfulCount int64        `json:"helpfulCount"`
+		ImageLinks   []string     `json:"imageLinks" gorm:"-"`
+		CreatedAt    time.Time    `json:"createdAt"`
+	}
+
+	// ReviewSummary aggregates the approved reviews of a product.
+	ReviewSummary struct {
+		ProductId     string  `json:"-"`
+		AverageRating float64 `json:"averageRating"`
+		ReviewCount   int64   `json:"reviewCount"`
+	}
+)
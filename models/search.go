@@ -0,0 +1,46 @@
+package models
+
+type (
+	// ProductSearchParams is bound from the product listing query string, unset filters
+	// are left out of the search.
+	ProductSearchParams struct {
+		SearchString string `form:"searchString"`
+		Category     string `form:"categoryFilter"`
+		Brand        string `form:"brandFilter"`
+		MinPrice     int    `form:"minPrice" binding:"omitempty,min=0"`
+		MaxPrice     int    `form:"maxPrice" binding:"omitempty,min=0,gtefield=MinPrice"`
+		Wireless     *bool  `form:"wireless"`
+		MinWarranty  int    `form:"minWarranty" binding:"omitempty,min=0"`
+		MinReturn    int    `form:"minReturn" binding:"omitempty,min=0"`
+		Colour       string `form:"colour"`
+		InStock      bool   `form:"inStock"`
+		// Status can only be chosen by admins, shoppers are always shown published products
+		Status ProductStatus `form:"status" binding:"omitempty,oneof=draft published"`
+		// Attributes are read from the attr.<key>, attr.<key>.min and attr.<key>.max parameters
+		Attributes []AttributeFilter `form:"-"`
+	}
+
+	FacetCount struct {
+		Value string `json:"value"`
+		Count int64  `json:"count"`
+	}
+
+	PriceBucket struct {
+		Min   int   `json:"min"`
+		Max   int   `json:"max,omitempty"`
+		Count int64 `json:"count"`
+	}
+
+	ProductFacets struct {
+		Brands       []FacetCount  `json:"brands"`
+		Categories   []FacetCount  `json:"categories"`
+		Wireless     []FacetCount  `json:"wireless"`
+		Colours      []FacetCount  `json:"colours"`
+		PriceBuckets []PriceBucket `json:"priceBuckets"`
+	}
+
+	ProductSearchResponse struct {
+		Response
+		Facets ProductFacets `json:"facets"`
+	}
+)
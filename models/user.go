@@ -15,11 +15,20 @@ const (
 	User  Roles = "user"
 )
 
+type TokenPurpose string
+
+const (
+	PasswordReset TokenPurpose = "passwordReset"
+	EmailChange   TokenPurpose = "emailChange"
+)
+
 type (
 	Users struct {
 		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
 		Email      string    `json:"email" gorm:"column:email;size:255;index:unique_email,unique,where:archived_at is not null"`
 		Password   string    `json:"password" gorm:"column:password;size:255"`
+		Name       string    `json:"name" gorm:"column:name;size:255"`
+		Phone      string    `json:"phone" gorm:"column:phone;size:20"`
 		Address    []Address `gorm:"foreignKey:UserId;references:Id"`
 		CreatedAt  time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
 		UpdatedAt  time.Time `json:"updated_at" gorm:"column:updated_at;default:current_timestamp"`
@@ -59,4 +68,142 @@ type (
 		EndedAt   time.Time `json:"ended_at" gorm:"default:null"`
 		User      Users     `gorm:"foreignKey:UserId"`
 	}
+
+	UserToken struct {
+		Id        string       `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId    string       `json:"user_id"`
+		User      Users        `gorm:"foreignKey:UserId"`
+		Purpose   TokenPurpose `json:"purpose" gorm:"column:purpose;type:token_purpose"`
+		TokenHash string       `json:"-" gorm:"column:token_hash;uniqueIndex"`
+		Payload   string       `json:"-" gorm:"column:payload"`
+		ExpiresAt time.Time    `json:"expires_at" gorm:"column:expires_at"`
+		UsedAt    time.Time    `json:"used_at" gorm:"column:used_at;default:null"`
+		CreatedAt time.Time    `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+	}
+
+	LoginThrottle struct {
+		Key          string    `json:"key" gorm:"column:key;primaryKey"`
+		Failures     int       `json:"failures" gorm:"column:failures"`
+		LastFailedAt time.Time `json:"last_failed_at" gorm:"column:last_failed_at"`
+		LockedUntil  time.Time `json:"locked_until" gorm:"column:locked_until;default:null"`
+	}
+
+	UserIdentity struct {
+		Id         string    `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId     string    `json:"user_id"`
+		User       Users     `gorm:"foreignKey:UserId"`
+		Provider   string    `json:"provider" gorm:"column:provider;uniqueIndex:unique_provider_subject"`
+		Subject    string    `json:"subject" gorm:"column:subject;uniqueIndex:unique_provider_subject"`
+		Email      string    `json:"email" gorm:"column:email;size:255"`
+		CreatedAt  time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt  time.Time `json:"updated_at" gorm:"column:updated_at;default:current_timestamp"`
+		ArchivedAt time.Time `json:"archived_at" gorm:"column:archived_at;default:null"`
+	}
+
+	OidcLoginState struct {
+		State        string    `json:"state" gorm:"column:state;primaryKey"`
+		Provider     string    `json:"provider" gorm:"column:provider"`
+		Nonce        string    `json:"-" gorm:"column:nonce"`
+		CodeVerifier string    `json:"-" gorm:"column:code_verifier"`
+		ExpiresAt    time.Time `json:"expires_at" gorm:"column:expires_at"`
+		CreatedAt    time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+	}
+
+	UserTotp struct {
+		Id           string    `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId       string    `json:"user_id" gorm:"column:user_id;uniqueIndex"`
+		User         Users     `gorm:"foreignKey:UserId"`
+		Secret       string    `json:"-" gorm:"column:secret"`
+		LastUsedStep int64     `json:"-" gorm:"column:last_used_step"`
+		EnabledAt    time.Time `json:"enabled_at" gorm:"column:enabled_at;default:null"`
+		CreatedAt    time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+		UpdatedAt    time.Time `json:"updated_at" gorm:"column:updated_at;default:current_timestamp"`
+	}
+
+	RecoveryCode struct {
+		Id        string    `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId    string    `json:"user_id" gorm:"column:user_id;index"`
+		User      Users     `gorm:"foreignKey:UserId"`
+		CodeHash  string    `json:"-" gorm:"column:code_hash"`
+		UsedAt    time.Time `json:"used_at" gorm:"column:used_at;default:null"`
+		CreatedAt time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+	}
+
+	LoginChallenge struct {
+		Id        string    `json:"id" gorm:"column:id;primaryKey;index"`
+		UserId    string    `json:"user_id"`
+		User      Users     `gorm:"foreignKey:UserId"`
+		TokenHash string    `json:"-" gorm:"column:token_hash;uniqueIndex"`
+		Role      Roles     `json:"role" gorm:"column:role;type:role_type"`
+		Attempts  int       `json:"attempts" gorm:"column:attempts"`
+		ExpiresAt time.Time `json:"expires_at" gorm:"column:expires_at"`
+		UsedAt    time.Time `json:"used_at" gorm:"column:used_at;default:null"`
+		CreatedAt time.Time `json:"created_at" gorm:"column:created_at;default:current_timestamp"`
+	}
+
+	LoginChallengeResponse struct {
+		ChallengeToken string    `json:"challengeToken"`
+		Next           string    `json:"next"`
+		ExpiresAt      time.Time `json:"expiresAt"`
+	}
+
+	TwoFactorBody struct {
+		ChallengeToken string `json:"challengeToken" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+
+	TotpCodeBody struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	TotpEnrollment struct {
+		Secret     string `json:"secret"`
+		OtpauthUrl string `json:"otpauthUrl"`
+	}
+
+	TwoFactorLogin struct {
+		Token         string   `json:"token"`
+		RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+	}
+
+	Profile struct {
+		Id        string    `json:"id"`
+		Email     string    `json:"email"`
+		Name      string    `json:"name"`
+		Phone     string    `json:"phone"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	ProfileBody struct {
+		Name  string `json:"name" binding:"max=255"`
+		Phone string `json:"phone" binding:"max=20"`
+	}
+
+	EmailChangeBody struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password"`
+	}
+
+	VerifyEmailBody struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	DeleteAccountBody struct {
+		Password string `json:"password"`
+	}
+
+	ForgotPasswordBody struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	ResetPasswordBody struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=8"`
+	}
+
+	ChangePasswordBody struct {
+		OldPassword string `json:"oldPassword" binding:"required"`
+		NewPassword string `json:"newPassword" binding:"required,min=8"`
+	}
 )
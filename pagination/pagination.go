@@ -0,0 +1,279 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const defaultLimit = 5
+
+var (
+	ErrInvalidCursor = errors.New("invalid pagination cursor")
+	ErrInvalidSort   = errors.New("invalid sort key")
+)
+
+type SortKey string
+
+const (
+	SortPrice      SortKey = "price"
+	SortNewest     SortKey = "newest"
+	SortName       SortKey = "name"
+	SortPopularity SortKey = "popularity"
+	SortRelevance  SortKey = "relevance"
+	SortRating     SortKey = "rating"
+	SortHelpful    SortKey = "helpful"
+)
+
+// defaultDescending is the direction a sort key is listed in unless order is given.
+var defaultDescending = map[SortKey]bool{
+	SortNewest:     true,
+	SortPopularity: true,
+	SortRelevance:  true,
+	SortRating:     true,
+	SortHelpful:    true,
+}
+
+// ColumnType is the postgres type cursor values are cast back into when comparing.
+type ColumnType string
+
+const (
+	Integer   ColumnType = "bigint"
+	Real      ColumnType = "real"
+	Text      ColumnType = "text"
+	Timestamp ColumnType = "timestamptz"
+)
+
+// Column is the sql expression a listing sorts by for a sort key, it must not be null.
+type Column struct {
+	Expr string
+	Vars []interface{}
+	Type ColumnType
+}
+
+type Columns map[SortKey]Column
+
+type query struct {
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+	Page   int    `form:"page" binding:"omitempty,min=1"`
+	Sort   string `form:"sort"`
+	Order  string `form:"order" binding:"omitempty,oneof=asc desc"`
+	Cursor string `form:"cursor"`
+}
+
+type cursor struct {
+	Sort     SortKey `json:"s"`
+	Desc     bool    `json:"d"`
+	Value    string  `json:"v"`
+	Id       string  `json:"i"`
+	Backward bool    `json:"b"`
+}
+
+// Params is one page request of a listing. Pages are addressed either by page number or,
+// to stay stable while rows are added, by the opaque cursors returned with the previous page.
+type Params struct {
+	Limit int
+	Page  int
+	Sort  SortKey
+	Desc  bool
+
+	cursor *cursor
+	// Next and Prev are set by Keys once the page has been fetched
+	Next string
+	Prev string
+}
+
+// FromQuery reads limit, page, sort, order and cursor from the query string, sort must be
+// one of allowed and defaults to defaultSort.
+func FromQuery(ctx *gin.Context, allowed []SortKey, defaultSort SortKey) (*Params, error) {
+	var q query
+	if err := ctx.ShouldBindQuery(&q); err != nil {
+		return nil, err
+	}
+
+	params := &Params{
+		Limit: q.Limit,
+		Page:  q.Page,
+		Sort:  defaultSort,
+	}
+	if params.Limit == 0 {
+		params.Limit = defaultLimit
+	}
+	if params.Page == 0 {
+		params.Page = 1
+	}
+	if q.Sort != "" {
+		params.Sort = SortKey(q.Sort)
+	}
+
+	if q.Cursor != "" {
+		decoded, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.cursor = decoded
+		params.Sort = decoded.Sort
+		params.Desc = decoded.Desc
+	} else if q.Order != "" {
+		params.Desc = q.Order == "desc"
+	} else {
+		params.Desc = defaultDescending[params.Sort]
+	}
+
+	for _, key := range allowed {
+		if key == params.Sort {
+			return params, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrInvalidSort, params.Sort)
+}
+
+// Keys runs query for the page and returns the ids of its rows in order, idColumn breaks
+// ties between equal sort values. Rows are loaded separately by these ids so listings can
+// keep using joins and preloads, Reorder puts them back into page order.
+func (p *Params) Keys(query *gorm.DB, idColumn string, columns Columns) ([]string, error) {
+	column, ok := columns[p.Sort]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSort, p.Sort)
+	}
+
+	backward := p.cursor != nil && p.cursor.Backward
+	// walking back to the previous page reads the rows before the cursor in reverse
+	descending := p.Desc != backward
+	if p.cursor != nil {
+		if err := column.validate(p.cursor.Value); err != nil {
+			return nil, err
+		}
+		operator := ">"
+		if descending {
+			operator = "<"
+		}
+		vars := append(append([]interface{}{}, column.Vars...), p.cursor.Value, p.cursor.Id)
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (cast(? as %s), ?)", column.Expr, idColumn, operator, column.Type), vars...)
+	} else if p.Page > 1 {
+		query = query.Offset(p.Limit * (p.Page - 1))
+	}
+
+	direction := "asc"
+	if descending {
+		direction = "desc"
+	}
+
+	var rows []struct {
+		Id        string
+		SortValue string
+	}
+	err := query.
+		Select(fmt.Sprintf("%s as id, %s as sort_value", idColumn, column.valueSQL()), column.Vars...).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                fmt.Sprintf("%s %s, %s %s", column.Expr, direction, idColumn, direction),
+			Vars:               column.Vars,
+			WithoutParentheses: true,
+		}}).
+		Limit(p.Limit + 1).
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	hasMore := len(rows) > p.Limit
+	if hasMore {
+		rows = rows[:p.Limit]
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.Id)
+	}
+	if len(rows) == 0 {
+		return ids, nil
+	}
+
+	first, last := rows[0], rows[len(rows)-1]
+	if backward || hasMore {
+		if p.Next, err = p.encodeCursor(last.SortValue, last.Id, false); err != nil {
+			return nil, err
+		}
+	}
+	if (backward && hasMore) || (!backward && (p.cursor != nil || p.Page > 1)) {
+		if p.Prev, err = p.encodeCursor(first.SortValue, first.Id, true); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// Reorder sorts rows loaded by the ids Keys returned back into page order, rows sharing
+// an id keep their relative order.
+func Reorder[T any](ids []string, rows []T, id func(T) string) {
+	position := make(map[string]int, len(ids))
+	for i, rowId := range ids {
+		position[rowId] = i
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return position[id(rows[i])] < position[id(rows[j])]
+	})
+}
+
+func (c Column) valueSQL() string {
+	if c.Type == Timestamp {
+		return fmt.Sprintf(`to_char((%s) at time zone 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')`, c.Expr)
+	}
+	return fmt.Sprintf("(%s)::text", c.Expr)
+}
+
+// validate rejects tampered cursor values before they reach the cast in the query.
+func (c Column) validate(value string) error {
+	var err error
+	switch c.Type {
+	case Integer:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case Real:
+		_, err = strconv.ParseFloat(value, 32)
+	case Timestamp:
+		_, err = time.Parse(time.RFC3339Nano, value)
+	}
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func (p *Params) encodeCursor(value string, id string, backward bool) (string, error) {
+	raw, err := json.Marshal(cursor{
+		Sort:     p.Sort,
+		Desc:     p.Desc,
+		Value:    value,
+		Id:       id,
+		Backward: backward,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	decoded := &cursor{}
+	if err := json.Unmarshal(raw, decoded); err != nil || decoded.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+	return decoded, nil
+}
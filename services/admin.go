@@ -1,30 +1,55 @@
 package services
 
 import (
+	"context"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
 )
 
 type AdminServices interface {
-	UploadImageFirebase(bucket string, imagePath string) (string, error)
+	UploadImage(ctx context.Context, data []byte) (models.Images, []models.ImageRendition, error)
 	CreateProduct(product *models.ProductBody) (string, error)
-	CreateCategory(categoryName string) error
-	CreateBrand(brandName string) error
+	CreateCategory(category *models.Category) error
+	CreateBrand(brand *models.Brand) error
 	CreateOffer(newOffer *models.Offer) error
 	CreateVariant(productId string, colour string, stock int, price int) (string, error)
 	UploadVariantImages(variantId string, imageIds []string) error
+	AddGalleryImages(productId string, variantId string, imageIds []string) error
+	GetVariantGallery(productId string, variantId string) ([]models.GalleryImage, error)
+	ReorderGallery(productId string, variantId string, imageIds []string) error
+	UpdateGalleryImage(productId string, variantId string, imageId string, details *models.GalleryImageBody) error
+	DetachImage(productId string, variantId string, imageId string) error
+	DeleteImage(ctx context.Context, imageId string) error
+	GetOrphanImages(params *pagination.Params) ([]models.OrphanImage, error)
+	CountOrphanImages() (int64, error)
+	CleanupOrphanImages(ctx context.Context) (int, error)
 	DeleteVariant(productId string, variantId string) error
 	DeleteProduct(productId string) error
 	DeleteCategory(categoryId string) error
 	DeleteBrand(brandId string) error
 	UpdateProduct(productId string, productDetails *models.Product) error
+	PublishProduct(productId string) error
+	UnpublishProduct(productId string) error
 	UpdateVariant(productId string, variantId string, variantDetails *models.Variants) error
-	UpdateCategory(categoryId string, categoryName string) error
-	UpdateBrand(brandId string, brandName string) error
-	GetAllUsers(limit int, page int) ([]models.Users, error)
+	SetVariantSale(productId string, variantId string, sale *models.VariantSaleBody) error
+	ClearVariantSale(productId string, variantId string) error
+	BulkUpdateVariants(details *models.BulkVariantUpdateBody) (models.BulkVariantUpdateResult, error)
+	UpdateCategory(categoryId string, categoryDetails *models.Category) error
+	UpdateBrand(brandId string, brandDetails *models.Brand) error
+	GetAllUsers(params *pagination.Params) ([]models.Users, error)
 	UsersCount() (int64, error)
-	GetAllBrands(limit int, page int) ([]models.Brand, error)
+	GetAllBrands(params *pagination.Params) ([]models.Brand, error)
 	GetBrandsCount() (int64, error)
-	GetAllCategory(limit int, page int) ([]models.Category, error)
+	GetAllCategory(params *pagination.Params) ([]models.Category, error)
 	GetCategoryCount() (int64, error)
+	GetCategoryTree() ([]models.CategoryNode, error)
 	ChangeUserRole(userId string, adminId string) error
+	CreateAttribute(categoryId string, attribute *models.AttributeBody) (string, error)
+	GetCategoryAttributes(categoryId string) ([]models.Attribute, error)
+	DeleteAttribute(categoryId string, attributeId string) error
+	SetProductAttributes(productId string, values models.ProductAttributes) error
+	CreateCatalogImport(adminId string, format models.CatalogFormat, dryRun bool, data []byte) (models.CatalogJob, error)
+	CreateCatalogExport(adminId string, format models.CatalogFormat) (models.CatalogJob, error)
+	GetCatalogJob(jobId string, withOutput bool) (models.CatalogJob, error)
+	RecoverCatalogJobs() (int64, error)
 }
@@ -1,12 +1,86 @@
 package admin
 
 import (
+	"errors"
+	"fmt"
 	"github.com/Shresth92/audiophile/internal"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
 	"time"
 )
 
+var (
+	userSortColumns = pagination.Columns{
+		pagination.SortNewest: {Expr: "created_at", Type: pagination.Timestamp},
+		pagination.SortName:   {Expr: "coalesce(name, '')", Type: pagination.Text},
+	}
+	brandSortColumns = pagination.Columns{
+		pagination.SortNewest: {Expr: "created_at", Type: pagination.Timestamp},
+		pagination.SortName:   {Expr: "brand_name", Type: pagination.Text},
+	}
+	categorySortColumns = pagination.Columns{
+		pagination.SortNewest: {Expr: "created_at", Type: pagination.Timestamp},
+		pagination.SortName:   {Expr: "category_name", Type: pagination.Text},
+	}
+	imageSortColumns = pagination.Columns{
+		pagination.SortNewest: {Expr: "created_at", Type: pagination.Timestamp},
+	}
+)
+
+// orphanImageCondition matches images that are neither in the gallery of a variant nor
+// attached to a review, including images detached from every gallery they were in.
+const orphanImageCondition = `NOT EXISTS (SELECT 1 FROM variant_images vi WHERE vi.image_id = images.id AND vi.archived_at IS NULL)
+	AND NOT EXISTS (SELECT 1 FROM review_images ri WHERE ri.image_id = images.id)`
+
+// neverAttachedImageCondition matches the orphaned images that were never in a gallery,
+// images an admin detached are left for the admin to delete.
+const neverAttachedImageCondition = `NOT EXISTS (SELECT 1 FROM variant_images vi WHERE vi.image_id = images.id)
+	AND NOT EXISTS (SELECT 1 FROM review_images ri WHERE ri.image_id = images.id)`
+
+type namedRow struct {
+	Id   string
+	Name string
+	Slug string
+}
+
+type catalogVariantRow struct {
+	ProductId   string
+	ProductName string
+	ModelName   string
+	BrandId     string
+	CategoryId  string
+	Return      int
+	Warranty    int
+	Wireless    bool
+	VariantId   string
+	Colour      string
+	Price       int
+	Stock       int
+}
+
+type productAttributeValueRow struct {
+	ProductId   string
+	Key         string
+	Type        models.AttributeType
+	TextValue   string
+	NumberValue *float64
+}
+
+type galleryImageRow struct {
+	ImageId   string
+	Path      string
+	Width     int
+	Height    int
+	Position  int
+	IsPrimary bool
+	AltText   string
+}
+
 type repository struct {
 	*internal.Database
 }
@@ -15,21 +89,19 @@ func newCartRepository(db *internal.Database) *repository {
 	return &repository{Database: db}
 }
 
-func (r *repository) uploadImageFirebase(bucket string, imagePath string) (string, error) {
-	imageId := uuid.New().String()
-	image := models.Images{
-		Id:         imageId,
-		BucketName: bucket,
-		Path:       imagePath,
-	}
-	err := r.Database.DB.
-		Model(&models.Images{}).
-		Create(&image).
-		Error
-	return imageId, err
+func (r *repository) createImage(image *models.Images, renditions []models.ImageRendition) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		if len(renditions) == 0 {
+			return nil
+		}
+		return tx.Create(&renditions).Error
+	})
 }
 
-func (r *repository) createProduct(product *models.ProductBody) (string, error) {
+func (r *repository) createProduct(product *models.ProductBody, attributeValues []models.ProductAttributeValue) (string, error) {
 	productId := uuid.New().String()
 	productInstance := models.Product{
 		Id:          productId,
@@ -41,18 +113,22 @@ func (r *repository) createProduct(product *models.ProductBody) (string, error)
 		Warranty:    product.Warranty,
 		Wireless:    product.Wireless,
 	}
-	err := r.Database.DB.
-		Model(&models.Product{}).
-		Create(&productInstance).
-		Error
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Product{}).Create(&productInstance).Error; err != nil {
+			return err
+		}
+		return createProductAttributeValues(tx, productId, attributeValues)
+	})
 	return productId, err
 }
 
-func (r *repository) createCategory(categoryName string) error {
+func (r *repository) createCategory(categoryName string, parentId *string, slug string) error {
 	categoryId := uuid.New().String()
 	category := models.Category{
 		Id:           categoryId,
 		CategoryName: categoryName,
+		ParentId:     parentId,
+		Slug:         slug,
 	}
 	err := r.Database.DB.
 		Model(&models.Category{}).
@@ -61,11 +137,12 @@ func (r *repository) createCategory(categoryName string) error {
 	return err
 }
 
-func (r *repository) createBrand(brandName string) error {
+func (r *repository) createBrand(brandName string, slug string) error {
 	brandId := uuid.New().String()
 	brand := models.Brand{
 		Id:        brandId,
 		BrandName: brandName,
+		Slug:      slug,
 	}
 	err := r.Database.DB.
 		Model(&models.Brand{}).
@@ -107,23 +184,290 @@ func (r *repository) createVariant(productId string, colour string, stock int, p
 	return variantId, err
 }
 
-func (r *repository) uploadVariantImages(variantId string, imageIds []string) error {
-	var variantImageArray []models.VariantImages
-	for _, imageId := range imageIds {
-		variantImageId := uuid.New().String()
-		imageStruct := models.VariantImages{
-			Id:        variantImageId,
-			VariantId: variantId,
-			ImageId:   imageId,
+// addGalleryImages appends the images to the end of the gallery, skipping those already in
+// it. The first image of an empty gallery becomes its primary image.
+func (r *repository) addGalleryImages(productId string, variantId string, imageIds []string) error {
+	if len(imageIds) == 0 {
+		return nil
+	}
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockGallery(tx, productId, variantId); err != nil {
+			return err
+		}
+		var found int64
+		err := tx.Model(&models.Images{}).
+			Where("id IN ? and archived_at is null", imageIds).
+			Count(&found).
+			Error
+		if err != nil {
+			return err
+		}
+		if int(found) != len(uniqueIds(imageIds)) {
+			return gorm.ErrRecordNotFound
+		}
+
+		var gallery []models.VariantImages
+		err = tx.Model(&models.VariantImages{}).
+			Where("variant_id = ? and archived_at is null", variantId).
+			Find(&gallery).
+			Error
+		if err != nil {
+			return err
+		}
+
+		attached := make(map[string]bool, len(gallery))
+		position, hasPrimary := 0, false
+		for _, image := range gallery {
+			attached[image.ImageId] = true
+			hasPrimary = hasPrimary || image.IsPrimary
+			if image.Position > position {
+				position = image.Position
+			}
+		}
+
+		var variantImageArray []models.VariantImages
+		for _, imageId := range imageIds {
+			if attached[imageId] {
+				continue
+			}
+			attached[imageId] = true
+			position++
+			variantImageArray = append(variantImageArray, models.VariantImages{
+				Id:        uuid.New().String(),
+				VariantId: variantId,
+				ImageId:   imageId,
+				Position:  position,
+				IsPrimary: !hasPrimary,
+			})
+			hasPrimary = true
+		}
+		if len(variantImageArray) == 0 {
+			return nil
+		}
+		return tx.Model(&models.VariantImages{}).Create(&variantImageArray).Error
+	})
+}
+
+func (r *repository) getVariantGallery(productId string, variantId string) ([]galleryImageRow, error) {
+	var variant models.Variants
+	err := r.Database.DB.
+		Model(&models.Variants{}).
+		Select("id").
+		Where("id = ? and product_id = ? and archived_at is null", variantId, productId).
+		First(&variant).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []galleryImageRow
+	err = r.Database.DB.
+		Table("variant_images vi").
+		Select("vi.image_id, i.path, coalesce(i.width, 0) as width, coalesce(i.height, 0) as height, vi.position, vi.is_primary, coalesce(vi.alt_text, '') as alt_text").
+		Joins("join images i on i.id = vi.image_id").
+		Where("vi.variant_id = ? and vi.archived_at is null", variantId).
+		Order("vi.is_primary desc, vi.position, vi.created_at").
+		Scan(&rows).
+		Error
+	return rows, err
+}
+
+// reorderGallery numbers the images in the order given, which must list the whole gallery.
+func (r *repository) reorderGallery(productId string, variantId string, imageIds []string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockGallery(tx, productId, variantId); err != nil {
+			return err
+		}
+		var attached []string
+		err := tx.Model(&models.VariantImages{}).
+			Where("variant_id = ? and archived_at is null", variantId).
+			Pluck("image_id", &attached).
+			Error
+		if err != nil {
+			return err
+		}
+
+		positions := make(map[string]int, len(imageIds))
+		for i, imageId := range imageIds {
+			if _, ok := positions[imageId]; ok {
+				return models.ErrInvalidGallery
+			}
+			positions[imageId] = i + 1
+		}
+		if len(attached) != len(positions) {
+			return models.ErrInvalidGallery
+		}
+		for _, imageId := range attached {
+			if _, ok := positions[imageId]; !ok {
+				return models.ErrInvalidGallery
+			}
+		}
+
+		for imageId, position := range positions {
+			err := tx.Model(&models.VariantImages{}).
+				Where("variant_id = ? and image_id = ? and archived_at is null", variantId, imageId).
+				Updates(map[string]interface{}{"position": position, "updated_at": time.Now()}).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *repository) updateGalleryImage(productId string, variantId string, imageId string, details *models.GalleryImageBody) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockGallery(tx, productId, variantId); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"updated_at": time.Now()}
+		if details.AltText != nil {
+			updates["alt_text"] = *details.AltText
+		}
+		if details.IsPrimary != nil {
+			if *details.IsPrimary {
+				err := tx.Model(&models.VariantImages{}).
+					Where("variant_id = ? and image_id <> ? and is_primary and archived_at is null", variantId, imageId).
+					Update("is_primary", false).
+					Error
+				if err != nil {
+					return err
+				}
+			}
+			updates["is_primary"] = *details.IsPrimary
+		}
+
+		result := tx.Model(&models.VariantImages{}).
+			Where("variant_id = ? and image_id = ? and archived_at is null", variantId, imageId).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ensurePrimary(tx, variantId, imageId)
+	})
+}
+
+// detachImage removes the image from the gallery, the image itself is kept until it is
+// deleted or cleaned up as an orphan.
+func (r *repository) detachImage(productId string, variantId string, imageId string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockGallery(tx, productId, variantId); err != nil {
+			return err
+		}
+		result := tx.Model(&models.VariantImages{}).
+			Where("variant_id = ? and image_id = ? and archived_at is null", variantId, imageId).
+			Updates(map[string]interface{}{"is_primary": false, "archived_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return ensurePrimary(tx, variantId, imageId)
+	})
+}
+
+// deleteImage removes the rows of an image matching condition and returns the paths of its
+// stored objects, it fails with ErrImageInUse when the image does not match.
+func (r *repository) deleteImage(imageId string, condition string) ([]string, error) {
+	var paths []string
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var image models.Images
+		err := tx.Model(&models.Images{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", imageId).
+			First(&image).
+			Error
+		if err != nil {
+			return err
+		}
+
+		var orphaned int64
+		err = tx.Model(&models.Images{}).
+			Where("id = ?", imageId).
+			Where(condition).
+			Count(&orphaned).
+			Error
+		if err != nil {
+			return err
+		}
+		if orphaned == 0 {
+			return models.ErrImageInUse
+		}
+
+		err = tx.Model(&models.ImageRendition{}).
+			Where("image_id = ?", imageId).
+			Pluck("path", &paths).
+			Error
+		if err != nil {
+			return err
+		}
+		paths = append(paths, image.Path)
+
+		if err := tx.Where("image_id = ?", imageId).Delete(&models.ImageRendition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_id = ?", imageId).Delete(&models.VariantImages{}).Error; err != nil {
+			return err
 		}
-		variantImageArray = append(variantImageArray, imageStruct)
+		return tx.Where("id = ?", imageId).Delete(&models.Images{}).Error
+	})
+	return paths, err
+}
+
+func (r *repository) getOrphanImages(params *pagination.Params) ([]models.Images, error) {
+	imageIds, err := params.Keys(r.Database.DB.Model(&models.Images{}).Where(orphanImageCondition), "id", imageSortColumns)
+	if err != nil || len(imageIds) == 0 {
+		return nil, err
 	}
 
+	var images []models.Images
+	err = r.Database.DB.
+		Model(&models.Images{}).
+		Where("id IN ?", imageIds).
+		Find(&images).
+		Error
+	pagination.Reorder(imageIds, images, func(image models.Images) string { return image.Id })
+	return images, err
+}
+
+func (r *repository) countOrphanImages() (int64, error) {
+	var count int64
 	err := r.Database.DB.
-		Model(&models.VariantImages{}).
-		Create(&variantImageArray).
+		Model(&models.Images{}).
+		Where(orphanImageCondition).
+		Count(&count).
 		Error
-	return err
+	return count, err
+}
+
+// neverAttachedImageIds returns a batch of images uploaded before createdBefore that were
+// never attached, ordered by id and starting after afterId.
+func (r *repository) neverAttachedImageIds(createdBefore time.Time, afterId string, limit int) ([]string, error) {
+	var imageIds []string
+	err := r.Database.DB.
+		Model(&models.Images{}).
+		Where(neverAttachedImageCondition).
+		Where("created_at < ? and id > ?", createdBefore, afterId).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &imageIds).
+		Error
+	return imageIds, err
+}
+
+func (r *repository) getImageRenditions(imageIds []string) ([]models.ImageRendition, error) {
+	var renditions []models.ImageRendition
+	err := r.Database.DB.
+		Model(&models.ImageRendition{}).
+		Where("image_id IN ?", imageIds).
+		Find(&renditions).
+		Error
+	return renditions, err
 }
 
 func (r *repository) deleteVariant(productId string, variantId string) error {
@@ -139,18 +483,36 @@ func (r *repository) deleteProduct(productId string) error {
 	err := r.Database.DB.
 		Model(&models.Product{}).
 		Where("id = ? and archived_at is null", productId).
-		Update("archived_at", time.Now()).
+		Updates(map[string]interface{}{"status": models.ProductArchived, "archived_at": time.Now()}).
 		Error
 	return err
 }
 
+// deleteCategory archives the category, its subcategories move up to its parent.
 func (r *repository) deleteCategory(categoryId string) error {
-	err := r.Database.DB.
-		Model(&models.Category{}).
-		Where("id = ? and archived_at is null", categoryId).
-		Update("archived_at", time.Now()).
-		Error
-	return err
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		err := tx.Model(&models.Category{}).
+			Where("id = ? and archived_at is null", categoryId).
+			First(&category).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.Category{}).
+			Where("parent_id = ? and archived_at is null", categoryId).
+			Update("parent_id", category.ParentId).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Category{}).
+			Where("id = ?", categoryId).
+			Update("archived_at", time.Now()).
+			Error
+	})
 }
 
 func (r *repository) deleteBrand(brandId string) error {
@@ -162,6 +524,58 @@ func (r *repository) deleteBrand(brandId string) error {
 	return err
 }
 
+// publishProduct shows the product to shoppers, it fails with ErrNotPublishable unless one
+// of its variants has an image.
+func (r *repository) publishProduct(productId string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		product := models.Product{}
+		err := tx.Model(&models.Product{}).
+			Where("id = ? and archived_at is null", productId).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&product).
+			Error
+		if err != nil {
+			return err
+		}
+
+		var publishable bool
+		err = tx.Raw(`SELECT EXISTS (
+			SELECT 1 FROM variants v
+			JOIN variant_images vi ON vi.variant_id = v.id AND vi.archived_at IS NULL
+			JOIN images i ON i.id = vi.image_id AND i.archived_at IS NULL
+			WHERE v.product_id = ? AND v.archived_at IS NULL
+		)`, productId).
+			Scan(&publishable).
+			Error
+		if err != nil {
+			return err
+		}
+		if !publishable {
+			return models.ErrNotPublishable
+		}
+
+		return tx.Model(&models.Product{}).
+			Where("id = ?", productId).
+			Updates(map[string]interface{}{"status": models.ProductPublished, "updated_at": time.Now()}).
+			Error
+	})
+}
+
+// unpublishProduct hides the product from shoppers by turning it back into a draft.
+func (r *repository) unpublishProduct(productId string) error {
+	result := r.Database.DB.
+		Model(&models.Product{}).
+		Where("id = ? and archived_at is null", productId).
+		Updates(map[string]interface{}{"status": models.ProductDraft, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
 func (r *repository) updateProduct(productId string, productDetails *models.Product) error {
 	product := models.Product{
 		ProductName: productDetails.ProductName,
@@ -195,22 +609,82 @@ func (r *repository) updateVariant(productId string, variantId string, variantDe
 	return err
 }
 
-func (r *repository) updateCategory(categoryId string, categoryName string) error {
-	category := models.Category{
-		CategoryName: categoryName,
-		UpdatedAt:    time.Now(),
+// setVariantSale schedules the sale of a variant, replacing any earlier one. It fails with
+// ErrInvalidSale when the sale price is not below the price of the variant.
+func (r *repository) setVariantSale(productId string, variantId string, sale *models.VariantSaleBody) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		variant := models.Variants{}
+		err := tx.Model(&models.Variants{}).
+			Where("id = ? and product_id = ? and archived_at is null", variantId, productId).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Take(&variant).
+			Error
+		if err != nil {
+			return err
+		}
+		if sale.SalePrice >= variant.Price {
+			return models.ErrInvalidSale
+		}
+
+		updates := map[string]interface{}{
+			"sale_price":     sale.SalePrice,
+			"sale_starts_at": nil,
+			"sale_ends_at":   nil,
+			"updated_at":     time.Now(),
+		}
+		if !sale.StartsAt.IsZero() {
+			updates["sale_starts_at"] = sale.StartsAt
+		}
+		if !sale.EndsAt.IsZero() {
+			updates["sale_ends_at"] = sale.EndsAt
+		}
+		return tx.Model(&models.Variants{}).Where("id = ?", variantId).Updates(updates).Error
+	})
+}
+
+func (r *repository) clearVariantSale(productId string, variantId string) error {
+	result := r.Database.DB.
+		Model(&models.Variants{}).
+		Where("id = ? and product_id = ? and archived_at is null", variantId, productId).
+		Updates(map[string]interface{}{"sale_price": nil, "sale_starts_at": nil, "sale_ends_at": nil, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// updateCategory applies the non empty fields of the category, an empty ParentId moves it
+// to the top level.
+func (r *repository) updateCategory(categoryId string, categoryDetails *models.Category) error {
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	if categoryDetails.CategoryName != "" {
+		updates["category_name"] = categoryDetails.CategoryName
+	}
+	if categoryDetails.Slug != "" {
+		updates["slug"] = categoryDetails.Slug
+	}
+	if categoryDetails.ParentId != nil {
+		if *categoryDetails.ParentId == "" {
+			updates["parent_id"] = nil
+		} else {
+			updates["parent_id"] = *categoryDetails.ParentId
+		}
 	}
 	err := r.Database.DB.
 		Model(&models.Category{}).
 		Where("id =  ?", categoryId).
-		Updates(&category).
+		Updates(updates).
 		Error
 	return err
 }
 
-func (r *repository) updateBrand(brandId string, brandName string) error {
+func (r *repository) updateBrand(brandId string, brandDetails *models.Brand) error {
 	brand := models.Brand{
-		BrandName: brandName,
+		BrandName: brandDetails.BrandName,
+		Slug:      brandDetails.Slug,
 		UpdatedAt: time.Now(),
 	}
 	err := r.Database.DB.
@@ -221,16 +695,57 @@ func (r *repository) updateBrand(brandId string, brandName string) error {
 	return err
 }
 
-func (r *repository) getAllUsers(limit int, page int) ([]models.Users, error) {
-	var users []models.Users
+// slugTaken reports whether an active row of model other than excludeId uses the slug.
+func (r *repository) slugTaken(model interface{}, slug string, excludeId string) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(model).
+		Where("slug = ? and id <> ? and archived_at is null", slug, excludeId).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// isValidParent checks parentId is an active category outside the subtree of categoryId,
+// so moving the category under it can not create a cycle.
+func (r *repository) isValidParent(categoryId string, parentId string) (bool, error) {
+	var count int64
+	err := r.Database.DB.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ?
+			UNION
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT count(*) FROM categories WHERE id = ? AND archived_at IS NULL AND id NOT IN (SELECT id FROM subtree)`, categoryId, parentId).
+		Scan(&count).
+		Error
+	return count > 0, err
+}
+
+func (r *repository) getCategoryTree() ([]models.Category, error) {
+	var categories []models.Category
 	err := r.Database.DB.
+		Model(&models.Category{}).
+		Where("archived_at is null").
+		Order("category_name").
+		Find(&categories).
+		Error
+	return categories, err
+}
+
+func (r *repository) getAllUsers(params *pagination.Params) ([]models.Users, error) {
+	userIds, err := params.Keys(r.Database.DB.Model(&models.Users{}).Where("archived_at is null"), "id", userSortColumns)
+	if err != nil || len(userIds) == 0 {
+		return nil, err
+	}
+
+	var users []models.Users
+	err = r.Database.DB.
 		Model(&models.Users{}).
 		Preload("Address").
-		Where("archived_at is null").
-		Limit(limit).
-		Offset(limit * (page - 1)).
+		Where("id IN ?", userIds).
 		Find(&users).
 		Error
+	pagination.Reorder(userIds, users, func(user models.Users) string { return user.Id })
 	return users, err
 }
 
@@ -244,15 +759,19 @@ func (r *repository) usersCount() (int64, error) {
 	return count, err
 }
 
-func (r *repository) getAllBrands(limit int, page int) ([]models.Brand, error) {
+func (r *repository) getAllBrands(params *pagination.Params) ([]models.Brand, error) {
+	brandIds, err := params.Keys(r.Database.DB.Model(&models.Brand{}).Where("archived_at is null"), "id", brandSortColumns)
+	if err != nil || len(brandIds) == 0 {
+		return nil, err
+	}
+
 	var brands []models.Brand
-	err := r.Database.DB.
+	err = r.Database.DB.
 		Model(&models.Brand{}).
-		Where("archived_at is null").
-		Limit(limit).
-		Offset(limit * (page - 1)).
+		Where("id IN ?", brandIds).
 		Scan(&brands).
 		Error
+	pagination.Reorder(brandIds, brands, func(brand models.Brand) string { return brand.Id })
 	return brands, err
 }
 
@@ -266,15 +785,19 @@ func (r *repository) getBrandsCount() (int64, error) {
 	return count, err
 }
 
-func (r *repository) getAllCategory(limit int, page int) ([]models.Category, error) {
+func (r *repository) getAllCategory(params *pagination.Params) ([]models.Category, error) {
+	categoryIds, err := params.Keys(r.Database.DB.Model(&models.Category{}).Where("archived_at is null"), "id", categorySortColumns)
+	if err != nil || len(categoryIds) == 0 {
+		return nil, err
+	}
+
 	var categories []models.Category
-	err := r.Database.DB.
+	err = r.Database.DB.
 		Model(&models.Category{}).
-		Where("archived_at is null").
-		Limit(limit).
-		Offset(limit * (page - 1)).
+		Where("id IN ?", categoryIds).
 		Scan(&categories).
 		Error
+	pagination.Reorder(categoryIds, categories, func(category models.Category) string { return category.Id })
 	return categories, err
 }
 
@@ -302,3 +825,411 @@ func (r *repository) changeUserRole(userId string, adminId string) error {
 		Error
 	return err
 }
+
+func (r *repository) createAttribute(categoryId string, attribute *models.AttributeBody) (string, error) {
+	attributeId := uuid.New().String()
+	err := r.Database.DB.
+		Model(&models.Attribute{}).
+		Create(&models.Attribute{
+			Id:         attributeId,
+			CategoryId: categoryId,
+			Key:        attribute.Key,
+			Name:       attribute.Name,
+			Type:       attribute.Type,
+			Unit:       attribute.Unit,
+		}).
+		Error
+	if isUniqueViolation(err) {
+		return "", models.ErrAttributeTaken
+	}
+	return attributeId, err
+}
+
+func (r *repository) getCategoryAttributes(categoryId string) ([]models.Attribute, error) {
+	var attributes []models.Attribute
+	err := r.Database.DB.
+		Model(&models.Attribute{}).
+		Where("category_id = ? and archived_at is null", categoryId).
+		Order("name").
+		Find(&attributes).
+		Error
+	return attributes, err
+}
+
+func (r *repository) getProductCategoryAttributes(productId string) ([]models.Attribute, error) {
+	var attributes []models.Attribute
+	err := r.Database.DB.
+		Model(&models.Attribute{}).
+		Joins("join products p on p.category_id = attributes.category_id").
+		Where("p.id = ? and attributes.archived_at is null", productId).
+		Find(&attributes).
+		Error
+	return attributes, err
+}
+
+// deleteAttribute archives the attribute and drops the values products had for it.
+func (r *repository) deleteAttribute(categoryId string, attributeId string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Attribute{}).
+			Where("id = ? and category_id = ? and archived_at is null", attributeId, categoryId).
+			Update("archived_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("attribute_id = ?", attributeId).Delete(&models.ProductAttributeValue{}).Error
+	})
+}
+
+// setProductAttributes replaces the attribute values of the product.
+func (r *repository) setProductAttributes(productId string, attributeValues []models.ProductAttributeValue) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", productId).Delete(&models.ProductAttributeValue{}).Error; err != nil {
+			return err
+		}
+		return createProductAttributeValues(tx, productId, attributeValues)
+	})
+}
+
+func createProductAttributeValues(tx *gorm.DB, productId string, attributeValues []models.ProductAttributeValue) error {
+	if len(attributeValues) == 0 {
+		return nil
+	}
+	for i := range attributeValues {
+		attributeValues[i].Id = uuid.New().String()
+		attributeValues[i].ProductId = productId
+	}
+	return tx.Model(&models.ProductAttributeValue{}).Create(&attributeValues).Error
+}
+
+func (r *repository) createCatalogJob(job *models.CatalogJob) error {
+	err := r.Database.DB.
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.CatalogJob{}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	err = r.Database.DB.
+		Model(&models.CatalogJob{}).
+		Create(job).
+		Error
+	return err
+}
+
+func (r *repository) getCatalogJob(jobId string, withOutput bool) (models.CatalogJob, error) {
+	job := models.CatalogJob{}
+	omit := []string{"input"}
+	if !withOutput {
+		omit = append(omit, "output")
+	}
+	err := r.Database.DB.
+		Model(&models.CatalogJob{}).
+		Omit(omit...).
+		Where("id = ?", jobId).
+		First(&job).
+		Error
+	return job, err
+}
+
+// updateCatalogJob saves the given columns of the job while it still has the given status
+// and reports whether it did, a job that timed out meanwhile is left alone.
+func (r *repository) updateCatalogJob(job *models.CatalogJob, status models.ExportStatus, columns ...string) (bool, error) {
+	result := r.Database.DB.
+		Model(job).
+		Where("status = ?", status).
+		Select(columns).
+		Updates(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+// failActiveCatalogJobs marks the pending and running catalog jobs created before cutoff as
+// failed and drops the uploaded files they kept.
+func (r *repository) failActiveCatalogJobs(cutoff time.Time, reason string) (int64, error) {
+	result := r.Database.DB.
+		Model(&models.CatalogJob{}).
+		Where("status IN ? AND created_at < ?", []models.ExportStatus{models.ExportPending, models.ExportRunning}, cutoff).
+		Updates(map[string]interface{}{
+			"status":       models.ExportFailed,
+			"input":        nil,
+			"error":        reason,
+			"completed_at": time.Now(),
+		})
+	return result.RowsAffected, result.Error
+}
+
+func (r *repository) getBrandNames() ([]namedRow, error) {
+	var brands []namedRow
+	err := r.Database.DB.
+		Model(&models.Brand{}).
+		Select("id, brand_name as name, slug").
+		Where("archived_at is null").
+		Scan(&brands).
+		Error
+	return brands, err
+}
+
+func (r *repository) getCategoryNames() ([]namedRow, error) {
+	var categories []namedRow
+	err := r.Database.DB.
+		Model(&models.Category{}).
+		Select("id, category_name as name, slug").
+		Where("archived_at is null").
+		Scan(&categories).
+		Error
+	return categories, err
+}
+
+func (r *repository) getAllAttributes() ([]models.Attribute, error) {
+	var attributes []models.Attribute
+	err := r.Database.DB.
+		Model(&models.Attribute{}).
+		Where("archived_at is null").
+		Find(&attributes).
+		Error
+	return attributes, err
+}
+
+func (r *repository) existingImageIds(imageIds []string) ([]string, error) {
+	var existing []string
+	if len(imageIds) == 0 {
+		return existing, nil
+	}
+	err := r.Database.DB.
+		Model(&models.Images{}).
+		Where("id IN ? and archived_at is null", imageIds).
+		Pluck("id", &existing).
+		Error
+	return existing, err
+}
+
+// existingProductKeys returns brand id and lower cased model name joined by a slash for
+// the active products of the brands.
+func (r *repository) existingProductKeys(brandIds []string) ([]string, error) {
+	var keys []string
+	if len(brandIds) == 0 {
+		return keys, nil
+	}
+	err := r.Database.DB.
+		Model(&models.Product{}).
+		Where("brand_id IN ? and archived_at is null", brandIds).
+		Pluck("brand_id || '/' || lower(model_name)", &keys).
+		Error
+	return keys, err
+}
+
+// importProduct creates the product with its attributes and variants, imageIds holds the
+// gallery of each variant.
+// importProduct creates a product of the import job, it fails with models.ErrJobStopped
+// once the job is no longer running. The job row stays share locked until the product is
+// saved, so a job is never failed halfway through one of its products.
+func (r *repository) importProduct(jobId string, product *models.Product, attributeValues []models.ProductAttributeValue, variants []models.Variants, imageIds [][]string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		var running []string
+		err := tx.
+			Model(&models.CatalogJob{}).
+			Clauses(clause.Locking{Strength: "SHARE"}).
+			Where("id = ? and status = ?", jobId, models.ExportRunning).
+			Pluck("id", &running).
+			Error
+		if err != nil {
+			return err
+		}
+		if len(running) == 0 {
+			return models.ErrJobStopped
+		}
+
+		if err := tx.Model(&models.Product{}).Create(product).Error; err != nil {
+			return err
+		}
+		if err := createProductAttributeValues(tx, product.Id, attributeValues); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Variants{}).Create(&variants).Error; err != nil {
+			return err
+		}
+
+		var variantImages []models.VariantImages
+		for i, variant := range variants {
+			for position, imageId := range imageIds[i] {
+				variantImages = append(variantImages, models.VariantImages{
+					Id:        uuid.New().String(),
+					VariantId: variant.Id,
+					ImageId:   imageId,
+					Position:  position + 1,
+					IsPrimary: position == 0,
+				})
+			}
+		}
+		if len(variantImages) == 0 {
+			return nil
+		}
+		return tx.Model(&models.VariantImages{}).Create(&variantImages).Error
+	})
+}
+
+func (r *repository) getCatalogVariants() ([]catalogVariantRow, error) {
+	var variants []catalogVariantRow
+	err := r.Database.DB.
+		Table("variants v").
+		Select("p.id as product_id, p.product_name, p.model_name, p.brand_id, p.category_id, p.return, p.warranty, p.wireless, v.id as variant_id, v.colour, v.price, v.stock").
+		Joins("join products p on p.id = v.product_id").
+		Where("p.archived_at is null and v.archived_at is null").
+		Order("p.created_at, p.id, v.created_at, v.id").
+		Scan(&variants).
+		Error
+	return variants, err
+}
+
+// getCatalogImages returns the galleries of all variants in the order they are shown.
+func (r *repository) getCatalogImages() ([]models.VariantImages, error) {
+	var images []models.VariantImages
+	err := r.Database.DB.
+		Model(&models.VariantImages{}).
+		Select("variant_id, image_id").
+		Where("archived_at is null").
+		Order("variant_id, is_primary desc, position, created_at").
+		Find(&images).
+		Error
+	return images, err
+}
+
+func (r *repository) getCatalogAttributeValues() ([]productAttributeValueRow, error) {
+	var values []productAttributeValueRow
+	err := r.Database.DB.
+		Table("product_attribute_values pav").
+		Select("pav.product_id, a.key, a.type, pav.text_value, pav.number_value").
+		Joins("join attributes a on a.id = pav.attribute_id and a.archived_at is null").
+		Order("pav.product_id, a.key, pav.id").
+		Scan(&values).
+		Error
+	return values, err
+}
+
+// bulkUpdateVariants applies the price and stock expressions to the active variants
+// matching filter in one transaction and returns them with their values before and after.
+// A preview only computes the new values, without locking or updating the variants.
+func (r *repository) bulkUpdateVariants(filter clause.Expr, price clause.Expr, stock clause.Expr, preview bool) ([]models.BulkVariantChange, error) {
+	var changes []models.BulkVariantChange
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Table("variants v").
+			Select("v.id as variant_id, p.id as product_id, p.product_name, v.colour, v.price as old_price, ? as new_price, v.stock as old_stock, ? as new_stock", price, stock).
+			Joins("join products p on p.id = v.product_id").
+			Where("p.archived_at is null and v.archived_at is null").
+			Where(filter).
+			Order("p.product_name, v.colour, v.id")
+		if !preview {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "v"}})
+		}
+		err := query.Scan(&changes).Error
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+
+		variantIds := make([]string, 0, len(changes))
+		for _, change := range changes {
+			if change.NewPrice <= 0 {
+				return fmt.Errorf("%w: the price of %s %s would not be positive", models.ErrInvalidBulkEdit, change.ProductName, change.Colour)
+			}
+			if change.NewStock < 0 {
+				return fmt.Errorf("%w: the stock of %s %s would be negative", models.ErrInvalidBulkEdit, change.ProductName, change.Colour)
+			}
+			variantIds = append(variantIds, change.VariantId)
+		}
+		if preview {
+			return nil
+		}
+
+		return tx.Exec("UPDATE variants AS v SET price = ?, stock = ?, updated_at = now() WHERE v.id IN ?", price, stock, variantIds).Error
+	})
+	return changes, err
+}
+
+// bulkVariantFilter matches the variants of the given brands, of the given categories and
+// their subcategories, and of the given products, filters left empty match everything.
+func bulkVariantFilter(details *models.BulkVariantUpdateBody) clause.Expr {
+	conditions := []string{"true"}
+	var vars []interface{}
+	if len(details.BrandIds) > 0 {
+		conditions = append(conditions, "p.brand_id IN ?")
+		vars = append(vars, details.BrandIds)
+	}
+	if len(details.CategoryIds) > 0 {
+		conditions = append(conditions, "p.category_id IN (WITH RECURSIVE tree AS ("+
+			"SELECT id FROM categories WHERE id IN ? AND archived_at IS NULL "+
+			"UNION SELECT sub.id FROM categories sub JOIN tree ON sub.parent_id = tree.id WHERE sub.archived_at IS NULL"+
+			") SELECT id FROM tree)")
+		vars = append(vars, details.CategoryIds)
+	}
+	if len(details.ProductIds) > 0 {
+		conditions = append(conditions, "p.id IN ?")
+		vars = append(vars, details.ProductIds)
+	}
+	return clause.Expr{SQL: strings.Join(conditions, " AND "), Vars: vars}
+}
+
+// priceExpression computes the adjusted price of variant v, or keeps it without adjustment.
+func priceExpression(adjustment *models.PriceAdjustment) clause.Expr {
+	if adjustment == nil {
+		return clause.Expr{SQL: "v.price"}
+	}
+	switch adjustment.Mode {
+	case models.AdjustSet:
+		return clause.Expr{SQL: "round(?::numeric)::int", Vars: []interface{}{adjustment.Value}}
+	case models.AdjustAmount:
+		return clause.Expr{SQL: "v.price + round(?::numeric)::int", Vars: []interface{}{adjustment.Value}}
+	}
+	return clause.Expr{SQL: "round(v.price * (100 + ?::numeric) / 100)::int", Vars: []interface{}{adjustment.Value}}
+}
+
+func stockExpression(adjustment *models.StockAdjustment) clause.Expr {
+	if adjustment == nil {
+		return clause.Expr{SQL: "v.stock"}
+	}
+	if adjustment.Mode == models.AdjustSet {
+		return clause.Expr{SQL: "?::int", Vars: []interface{}{adjustment.Value}}
+	}
+	return clause.Expr{SQL: "v.stock + ?::int", Vars: []interface{}{adjustment.Value}}
+}
+
+// lockGallery locks the variant so changes to its gallery are applied one after the other,
+// the product is not checked when productId is empty.
+func lockGallery(tx *gorm.DB, productId string, variantId string) error {
+	query := tx.Model(&models.Variants{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id = ? and archived_at is null", variantId)
+	if productId != "" {
+		query = query.Where("product_id = ?", productId)
+	}
+	var variant models.Variants
+	return query.First(&variant).Error
+}
+
+// ensurePrimary makes the first image of a gallery left without a primary image primary,
+// preferring any other image over skipImageId.
+func ensurePrimary(tx *gorm.DB, variantId string, skipImageId string) error {
+	return tx.Exec(`UPDATE variant_images SET is_primary = true, updated_at = now() WHERE id = (
+			SELECT id FROM variant_images WHERE variant_id = ? AND archived_at IS NULL
+			ORDER BY image_id = ?, position, created_at LIMIT 1
+		) AND NOT EXISTS (SELECT 1 FROM variant_images WHERE variant_id = ? AND archived_at IS NULL AND is_primary)`,
+		variantId, skipImageId, variantId).
+		Error
+}
+
+// isUniqueViolation reports whether err was raised by a unique index.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func uniqueIds(ids []string) map[string]bool {
+	unique := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
@@ -1,32 +1,101 @@
 package admin
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/internal/catalogfile"
+	"github.com/Shresth92/audiophile/internal/storage"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const (
+	// orphanImageGracePeriod leaves uploads alone long enough to be attached to the product
+	// or review they were uploaded for
+	orphanImageGracePeriod = 24 * time.Hour
+	orphanImageBatchSize   = 100
+	catalogJobRetention    = 7 * 24 * time.Hour
+	// catalogJobTimeout is how long a catalog job may stay pending or running before it is
+	// failed, an import still running by then stops before its next product
+	catalogJobTimeout = 30 * time.Minute
+	// maxStoredRowErrors keeps a file full of mistakes from bloating its import job, the
+	// failed rows are still all counted
+	maxStoredRowErrors = 1000
+)
+
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
 type Service struct {
-	repo *repository
+	repo      *repository
+	store     storage.ObjectStore
+	imageURLs *storage.ImageURLService
 }
 
-func NewAdminService(db *internal.Database) *Service {
-	return &Service{repo: newCartRepository(db)}
+func NewAdminService(db *internal.Database, store storage.ObjectStore, imageURLs *storage.ImageURLService) *Service {
+	return &Service{
+		repo:      newCartRepository(db),
+		store:     store,
+		imageURLs: imageURLs,
+	}
 }
 
-func (s *Service) UploadImageFirebase(bucket string, imagePath string) (string, error) {
-	return s.repo.uploadImageFirebase(bucket, imagePath)
+// UploadImage verifies data is an image, then stores it along with its renditions under
+// images/<image id>/. Stored objects are removed again when saving the image fails.
+func (s *Service) UploadImage(ctx context.Context, data []byte) (models.Images, []models.ImageRendition, error) {
+	return storage.StoreImage(ctx, s.store, data, s.repo.createImage)
 }
 
+// CreateProduct validates the attributes against the category before anything is created.
 func (s *Service) CreateProduct(product *models.ProductBody) (string, error) {
-	return s.repo.createProduct(product)
+	var attributeValues []models.ProductAttributeValue
+	if len(product.Attributes) > 0 {
+		attributes, err := s.repo.getCategoryAttributes(product.CategoryID)
+		if err != nil {
+			return "", err
+		}
+		if attributeValues, err = productAttributeValues(attributes, product.Attributes); err != nil {
+			return "", err
+		}
+	}
+	return s.repo.createProduct(product, attributeValues)
 }
 
-func (s *Service) CreateCategory(categoryName string) error {
-	return s.repo.createCategory(categoryName)
+// CreateCategory adds the category under ParentId, or at the top level when it is empty.
+func (s *Service) CreateCategory(category *models.Category) error {
+	var parentId *string
+	if category.ParentId != nil && *category.ParentId != "" {
+		valid, err := s.repo.isValidParent("", *category.ParentId)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return models.ErrInvalidParent
+		}
+		parentId = category.ParentId
+	}
+	slug, err := s.slug(&models.Category{}, "", category.Slug, category.CategoryName)
+	if err != nil {
+		return err
+	}
+	return s.repo.createCategory(category.CategoryName, parentId, slug)
 }
 
-func (s *Service) CreateBrand(brandName string) error {
-	return s.repo.createBrand(brandName)
+func (s *Service) CreateBrand(brand *models.Brand) error {
+	slug, err := s.slug(&models.Brand{}, "", brand.Slug, brand.BrandName)
+	if err != nil {
+		return err
+	}
+	return s.repo.createBrand(brand.BrandName, slug)
 }
 
 func (s *Service) CreateOffer(newOffer *models.Offer) error {
@@ -38,7 +107,145 @@ func (s *Service) CreateVariant(productId string, colour string, stock int, pric
 }
 
 func (s *Service) UploadVariantImages(variantId string, imageIds []string) error {
-	return s.repo.uploadVariantImages(variantId, imageIds)
+	return s.repo.addGalleryImages("", variantId, imageIds)
+}
+
+func (s *Service) AddGalleryImages(productId string, variantId string, imageIds []string) error {
+	return s.repo.addGalleryImages(productId, variantId, imageIds)
+}
+
+func (s *Service) GetVariantGallery(productId string, variantId string) ([]models.GalleryImage, error) {
+	rows, err := s.repo.getVariantGallery(productId, variantId)
+	if err != nil || len(rows) == 0 {
+		return []models.GalleryImage{}, err
+	}
+
+	imageIds := make([]string, 0, len(rows))
+	images := make([]models.Images, 0, len(rows))
+	for _, row := range rows {
+		imageIds = append(imageIds, row.ImageId)
+		images = append(images, models.Images{Id: row.ImageId, Path: row.Path, Width: row.Width, Height: row.Height})
+	}
+	renditions, err := s.imageRenditions(imageIds)
+	if err != nil {
+		return nil, err
+	}
+	urls := s.imageURLs.Images(images, renditions)
+
+	gallery := make([]models.GalleryImage, 0, len(rows))
+	for _, row := range rows {
+		image := models.GalleryImage{ImageURLs: urls[row.ImageId], Position: row.Position, IsPrimary: row.IsPrimary}
+		image.AltText = row.AltText
+		gallery = append(gallery, image)
+	}
+	return gallery, nil
+}
+
+func (s *Service) ReorderGallery(productId string, variantId string, imageIds []string) error {
+	return s.repo.reorderGallery(productId, variantId, imageIds)
+}
+
+func (s *Service) UpdateGalleryImage(productId string, variantId string, imageId string, details *models.GalleryImageBody) error {
+	return s.repo.updateGalleryImage(productId, variantId, imageId, details)
+}
+
+func (s *Service) DetachImage(productId string, variantId string, imageId string) error {
+	return s.repo.detachImage(productId, variantId, imageId)
+}
+
+// DeleteImage deletes an image that is no longer attached anywhere along with its stored
+// objects.
+func (s *Service) DeleteImage(ctx context.Context, imageId string) error {
+	return s.deleteImage(ctx, imageId, orphanImageCondition)
+}
+
+func (s *Service) deleteImage(ctx context.Context, imageId string, condition string) error {
+	paths, err := s.repo.deleteImage(imageId, condition)
+	if err != nil {
+		return err
+	}
+	s.deleteObjects(ctx, paths)
+	return nil
+}
+
+func (s *Service) GetOrphanImages(params *pagination.Params) ([]models.OrphanImage, error) {
+	images, err := s.repo.getOrphanImages(params)
+	if err != nil || len(images) == 0 {
+		return []models.OrphanImage{}, err
+	}
+
+	imageIds := make([]string, 0, len(images))
+	for _, image := range images {
+		imageIds = append(imageIds, image.Id)
+	}
+	renditions, err := s.imageRenditions(imageIds)
+	if err != nil {
+		return nil, err
+	}
+	urls := s.imageURLs.Images(images, renditions)
+
+	orphans := make([]models.OrphanImage, 0, len(images))
+	for _, image := range images {
+		orphans = append(orphans, models.OrphanImage{ImageURLs: urls[image.Id], Size: image.Size, CreatedAt: image.CreatedAt})
+	}
+	return orphans, nil
+}
+
+func (s *Service) CountOrphanImages() (int64, error) {
+	return s.repo.countOrphanImages()
+}
+
+// CleanupOrphanImages deletes the images older than orphanImageGracePeriod that were never
+// attached to a variant or review and returns how many were deleted. Images attached
+// while the cleanup runs are skipped, detached ones are only deleted by DeleteImage.
+func (s *Service) CleanupOrphanImages(ctx context.Context) (int, error) {
+	createdBefore := time.Now().Add(-orphanImageGracePeriod)
+	deleted, afterId := 0, ""
+	for {
+		imageIds, err := s.repo.neverAttachedImageIds(createdBefore, afterId, orphanImageBatchSize)
+		if err != nil {
+			return deleted, err
+		}
+		for _, imageId := range imageIds {
+			if err := ctx.Err(); err != nil {
+				return deleted, err
+			}
+			err := s.deleteImage(ctx, imageId, neverAttachedImageCondition)
+			if errors.Is(err, models.ErrImageInUse) || errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+		if len(imageIds) < orphanImageBatchSize {
+			return deleted, nil
+		}
+		afterId = imageIds[len(imageIds)-1]
+	}
+}
+
+func (s *Service) imageRenditions(imageIds []string) (map[string][]models.ImageRendition, error) {
+	renditions, err := s.repo.getImageRenditions(imageIds)
+	if err != nil {
+		return nil, err
+	}
+	byImage := make(map[string][]models.ImageRendition, len(imageIds))
+	for _, rendition := range renditions {
+		byImage[rendition.ImageId] = append(byImage[rendition.ImageId], rendition)
+	}
+	return byImage, nil
+}
+
+// deleteObjects removes stored objects whose rows are already gone, failures only leave
+// unreferenced files behind so they are logged.
+func (s *Service) deleteObjects(ctx context.Context, paths []string) {
+	for _, path := range paths {
+		if err := s.store.Delete(ctx, path); err != nil && !errors.Is(err, storage.ErrObjectNotFound) {
+			logrus.Errorf("deleteObjects: error in removing %s err: %v", path, err)
+		}
+	}
 }
 
 func (s *Service) DeleteVariant(productId string, variantId string) error {
@@ -61,36 +268,148 @@ func (s *Service) UpdateProduct(productId string, productDetails *models.Product
 	return s.repo.updateProduct(productId, productDetails)
 }
 
+func (s *Service) PublishProduct(productId string) error {
+	return s.repo.publishProduct(productId)
+}
+
+func (s *Service) UnpublishProduct(productId string) error {
+	return s.repo.unpublishProduct(productId)
+}
+
 func (s *Service) UpdateVariant(productId string, variantId string, variantDetails *models.Variants) error {
 	return s.repo.updateVariant(productId, variantId, variantDetails)
 }
 
-func (s *Service) UpdateCategory(categoryId string, categoryName string) error {
-	return s.repo.updateCategory(categoryId, categoryName)
+// SetVariantSale sells the variant at the sale price from StartsAt, or right away, until
+// EndsAt, or until the sale is removed.
+func (s *Service) SetVariantSale(productId string, variantId string, sale *models.VariantSaleBody) error {
+	if !sale.EndsAt.IsZero() && (!sale.EndsAt.After(time.Now()) || !sale.EndsAt.After(sale.StartsAt)) {
+		return models.ErrInvalidSale
+	}
+	return s.repo.setVariantSale(productId, variantId, sale)
+}
+
+func (s *Service) ClearVariantSale(productId string, variantId string) error {
+	return s.repo.clearVariantSale(productId, variantId)
 }
 
-func (s *Service) UpdateBrand(brandId string, brandName string) error {
-	return s.repo.updateBrand(brandId, brandName)
+// UpdateCategory keeps the slug of a renamed category unless a new one is given, so
+// existing links to it stay valid.
+func (s *Service) UpdateCategory(categoryId string, categoryDetails *models.Category) error {
+	if categoryDetails.ParentId != nil && *categoryDetails.ParentId != "" {
+		valid, err := s.repo.isValidParent(categoryId, *categoryDetails.ParentId)
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return models.ErrInvalidParent
+		}
+	}
+	categoryDetails.Slug = utils.Slugify(categoryDetails.Slug)
+	if categoryDetails.Slug != "" {
+		slug, err := s.slug(&models.Category{}, categoryId, categoryDetails.Slug, "")
+		if err != nil {
+			return err
+		}
+		categoryDetails.Slug = slug
+	}
+	return s.repo.updateCategory(categoryId, categoryDetails)
 }
 
-func (s *Service) GetAllUsers(limit int, page int) ([]models.Users, error) {
-	return s.repo.getAllUsers(limit, page)
+func (s *Service) UpdateBrand(brandId string, brandDetails *models.Brand) error {
+	brandDetails.Slug = utils.Slugify(brandDetails.Slug)
+	if brandDetails.Slug != "" {
+		slug, err := s.slug(&models.Brand{}, brandId, brandDetails.Slug, "")
+		if err != nil {
+			return err
+		}
+		brandDetails.Slug = slug
+	}
+	return s.repo.updateBrand(brandId, brandDetails)
+}
+
+// GetCategoryTree returns the active categories nested under their parents, subcategories
+// of an archived category would be unreachable and are left out.
+func (s *Service) GetCategoryTree() ([]models.CategoryNode, error) {
+	categories, err := s.repo.getCategoryTree()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]models.Category)
+	for _, category := range categories {
+		parentId := ""
+		if category.ParentId != nil {
+			parentId = *category.ParentId
+		}
+		children[parentId] = append(children[parentId], category)
+	}
+
+	var build func(parentId string) []models.CategoryNode
+	build = func(parentId string) []models.CategoryNode {
+		nodes := make([]models.CategoryNode, 0, len(children[parentId]))
+		for _, category := range children[parentId] {
+			nodes = append(nodes, models.CategoryNode{
+				Id:           category.Id,
+				CategoryName: category.CategoryName,
+				Slug:         category.Slug,
+				Children:     build(category.Id),
+			})
+		}
+		return nodes
+	}
+	return build(""), nil
+}
+
+// slug returns the requested slug, which must be free, or when none is requested one
+// generated from name with a numeric suffix appended until it is free.
+func (s *Service) slug(model interface{}, id string, requested string, name string) (string, error) {
+	if slug := utils.Slugify(requested); slug != "" {
+		taken, err := s.repo.slugTaken(model, slug, id)
+		if err != nil {
+			return "", err
+		}
+		if taken {
+			return "", models.ErrSlugTaken
+		}
+		return slug, nil
+	}
+
+	base := utils.Slugify(name)
+	if base == "" {
+		base = "item"
+	}
+	slug := base
+	for suffix := 2; ; suffix++ {
+		taken, err := s.repo.slugTaken(model, slug, id)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, suffix)
+	}
+}
+
+func (s *Service) GetAllUsers(params *pagination.Params) ([]models.Users, error) {
+	return s.repo.getAllUsers(params)
 }
 
 func (s *Service) UsersCount() (int64, error) {
 	return s.repo.usersCount()
 }
 
-func (s *Service) GetAllBrands(limit int, page int) ([]models.Brand, error) {
-	return s.repo.getAllBrands(limit, page)
+func (s *Service) GetAllBrands(params *pagination.Params) ([]models.Brand, error) {
+	return s.repo.getAllBrands(params)
 }
 
 func (s *Service) GetBrandsCount() (int64, error) {
 	return s.repo.getBrandsCount()
 }
 
-func (s *Service) GetAllCategory(limit int, page int) ([]models.Category, error) {
-	return s.repo.getAllCategory(limit, page)
+func (s *Service) GetAllCategory(params *pagination.Params) ([]models.Category, error) {
+	return s.repo.getAllCategory(params)
 }
 
 func (s *Service) GetCategoryCount() (int64, error) {
@@ -100,3 +419,510 @@ func (s *Service) GetCategoryCount() (int64, error) {
 func (s *Service) ChangeUserRole(userId string, adminId string) error {
 	return s.repo.changeUserRole(userId, adminId)
 }
+
+func (s *Service) CreateAttribute(categoryId string, attribute *models.AttributeBody) (string, error) {
+	if !attributeKeyPattern.MatchString(attribute.Key) {
+		return "", fmt.Errorf("%w: key must be lower case letters, digits and underscores", models.ErrInvalidAttribute)
+	}
+	return s.repo.createAttribute(categoryId, attribute)
+}
+
+func (s *Service) GetCategoryAttributes(categoryId string) ([]models.Attribute, error) {
+	return s.repo.getCategoryAttributes(categoryId)
+}
+
+func (s *Service) DeleteAttribute(categoryId string, attributeId string) error {
+	return s.repo.deleteAttribute(categoryId, attributeId)
+}
+
+func (s *Service) SetProductAttributes(productId string, values models.ProductAttributes) error {
+	attributes, err := s.repo.getProductCategoryAttributes(productId)
+	if err != nil {
+		return err
+	}
+	attributeValues, err := productAttributeValues(attributes, values)
+	if err != nil {
+		return err
+	}
+	return s.repo.setProductAttributes(productId, attributeValues)
+}
+
+// BulkUpdateVariants adjusts the price and stock of the variants matching the filters all at
+// once, either every variant is updated or none is.
+func (s *Service) BulkUpdateVariants(details *models.BulkVariantUpdateBody) (models.BulkVariantUpdateResult, error) {
+	if len(details.BrandIds) == 0 && len(details.CategoryIds) == 0 && len(details.ProductIds) == 0 {
+		return models.BulkVariantUpdateResult{}, fmt.Errorf("%w: select variants by brand, category or product", models.ErrInvalidBulkEdit)
+	}
+	if details.Price == nil && details.Stock == nil {
+		return models.BulkVariantUpdateResult{}, fmt.Errorf("%w: adjust the price or the stock", models.ErrInvalidBulkEdit)
+	}
+
+	changes, err := s.repo.bulkUpdateVariants(bulkVariantFilter(details), priceExpression(details.Price), stockExpression(details.Stock), details.Preview)
+	if err != nil {
+		return models.BulkVariantUpdateResult{}, err
+	}
+	if changes == nil {
+		changes = []models.BulkVariantChange{}
+	}
+	return models.BulkVariantUpdateResult{
+		Preview:  details.Preview,
+		Variants: len(changes),
+		Changes:  changes,
+	}, nil
+}
+
+// CreateCatalogImport queues importing the products in data, a dry run only validates the
+// rows and reports what would be created.
+func (s *Service) CreateCatalogImport(adminId string, format models.CatalogFormat, dryRun bool, data []byte) (models.CatalogJob, error) {
+	job := models.CatalogJob{
+		Id:        uuid.New().String(),
+		AdminId:   adminId,
+		Kind:      models.CatalogImport,
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    models.ExportPending,
+		Input:     data,
+		RowErrors: []models.ImportRowError{},
+		ExpiresAt: time.Now().Add(catalogJobRetention),
+	}
+	if err := s.repo.createCatalogJob(&job); err != nil {
+		return job, err
+	}
+
+	go s.runCatalogJob(job)
+	return job, nil
+}
+
+// CreateCatalogExport queues writing every active variant into a file in the format of
+// imports, so it can be edited and imported elsewhere.
+func (s *Service) CreateCatalogExport(adminId string, format models.CatalogFormat) (models.CatalogJob, error) {
+	job := models.CatalogJob{
+		Id:        uuid.New().String(),
+		AdminId:   adminId,
+		Kind:      models.CatalogExport,
+		Format:    format,
+		Status:    models.ExportPending,
+		RowErrors: []models.ImportRowError{},
+		ExpiresAt: time.Now().Add(catalogJobRetention),
+	}
+	if err := s.repo.createCatalogJob(&job); err != nil {
+		return job, err
+	}
+
+	go s.runCatalogJob(job)
+	return job, nil
+}
+
+func (s *Service) GetCatalogJob(jobId string, withOutput bool) (models.CatalogJob, error) {
+	return s.repo.getCatalogJob(jobId, withOutput)
+}
+
+// RecoverCatalogJobs fails the catalog jobs that are pending or running for longer than
+// catalogJobTimeout, like those of an instance of the app that stopped while running them.
+func (s *Service) RecoverCatalogJobs() (int64, error) {
+	return s.repo.failActiveCatalogJobs(time.Now().Add(-catalogJobTimeout), "job timed out, please start it again")
+}
+
+func (s *Service) runCatalogJob(job models.CatalogJob) {
+	job.Status = models.ExportRunning
+	started, err := s.repo.updateCatalogJob(&job, models.ExportPending, "status")
+	if err != nil {
+		logrus.Errorf("runCatalogJob: error in updating job %s err: %v", job.Id, err)
+		return
+	}
+	if !started {
+		return
+	}
+
+	if job.Kind == models.CatalogImport {
+		err = s.importCatalog(&job)
+	} else {
+		err = s.exportCatalog(&job)
+	}
+	job.Status = models.ExportCompleted
+	if err != nil {
+		logrus.Errorf("runCatalogJob: error in running job %s err: %v", job.Id, err)
+		job.Status = models.ExportFailed
+		job.Error = err.Error()
+	}
+	job.Input = nil
+	job.CompletedAt = time.Now()
+
+	saved, err := s.repo.updateCatalogJob(&job, models.ExportRunning, "status", "input", "output", "total_rows", "failed_rows", "products", "variants", "row_errors", "error", "completed_at")
+	if err != nil {
+		logrus.Errorf("runCatalogJob: error in saving job %s err: %v", job.Id, err)
+	}
+	if err == nil && !saved {
+		logrus.Warnf("runCatalogJob: job %s timed out before it was saved", job.Id)
+	}
+}
+
+// importedProduct collects the valid rows of one product in an import file.
+type importedProduct struct {
+	product         models.Product
+	attributeValues []models.ProductAttributeValue
+	variants        []models.Variants
+	imageIds        [][]string
+	lines           []int
+	colours         map[string]bool
+}
+
+// importCatalog creates the products of the job input. A row with a mistake is skipped with
+// a row error while the other rows of its product are still imported, products that
+// already exist with the same brand and model name are skipped entirely.
+func (s *Service) importCatalog(job *models.CatalogJob) error {
+	rows, rowErrors, err := catalogfile.Decode(job.Format, job.Input)
+	if err != nil {
+		return err
+	}
+	job.TotalRows = len(rows) + len(rowErrors)
+	addRowErrors(job, rowErrors...)
+
+	brands, categories, err := s.catalogNames()
+	if err != nil {
+		return err
+	}
+	allAttributes, err := s.repo.getAllAttributes()
+	if err != nil {
+		return err
+	}
+	attributes := make(map[string][]models.Attribute)
+	for _, attribute := range allAttributes {
+		attributes[attribute.CategoryId] = append(attributes[attribute.CategoryId], attribute)
+	}
+	var imageIds []string
+	for _, row := range rows {
+		imageIds = append(imageIds, row.ImageIds...)
+	}
+	existingImages, err := s.repo.existingImageIds(imageIds)
+	if err != nil {
+		return err
+	}
+	images := uniqueIds(existingImages)
+
+	var products []*importedProduct
+	productsByKey := make(map[string]*importedProduct)
+	for _, row := range rows {
+		rowError := func(message string) {
+			addRowErrors(job, models.ImportRowError{Line: row.Line, Message: message})
+		}
+		row.ProductName = strings.TrimSpace(row.ProductName)
+		row.ModelName = strings.TrimSpace(row.ModelName)
+		row.Colour = strings.TrimSpace(row.Colour)
+		brandId, categoryId, err := validateCatalogRow(row, brands, categories, images)
+		if err != nil {
+			rowError(err.Error())
+			continue
+		}
+
+		key := brandId + "/" + strings.ToLower(row.ModelName)
+		product, ok := productsByKey[key]
+		if !ok {
+			attributeValues, err := productAttributeValues(attributes[categoryId], row.Attributes)
+			if err != nil {
+				rowError(err.Error())
+				continue
+			}
+			product = &importedProduct{
+				product: models.Product{
+					Id:          uuid.New().String(),
+					ProductName: row.ProductName,
+					ModelName:   row.ModelName,
+					BrandId:     brandId,
+					CategoryId:  categoryId,
+					Return:      row.Return,
+					Warranty:    row.Warranty,
+					Wireless:    row.Wireless,
+				},
+				attributeValues: attributeValues,
+				colours:         make(map[string]bool),
+			}
+			productsByKey[key] = product
+			products = append(products, product)
+		} else if product.product.CategoryId != categoryId || !strings.EqualFold(product.product.ProductName, row.ProductName) {
+			rowError(fmt.Sprintf("product name or category differs from line %d of the same product", product.lines[0]))
+			continue
+		}
+
+		colour := strings.ToLower(row.Colour)
+		if product.colours[colour] {
+			rowError(fmt.Sprintf("colour %q is listed twice for the product", row.Colour))
+			continue
+		}
+		product.colours[colour] = true
+		product.variants = append(product.variants, models.Variants{
+			Id:        uuid.New().String(),
+			ProductId: product.product.Id,
+			Colour:    row.Colour,
+			Price:     row.Price,
+			Stock:     row.Stock,
+		})
+		product.imageIds = append(product.imageIds, row.ImageIds)
+		product.lines = append(product.lines, row.Line)
+	}
+
+	brandIds := make([]string, 0, len(products))
+	for _, product := range products {
+		brandIds = append(brandIds, product.product.BrandId)
+	}
+	existingKeys, err := s.repo.existingProductKeys(brandIds)
+	if err != nil {
+		return err
+	}
+	existing := uniqueIds(existingKeys)
+
+	for _, product := range products {
+		productErrors := func(message string) {
+			for _, line := range product.lines {
+				addRowErrors(job, models.ImportRowError{Line: line, Message: message})
+			}
+		}
+		if existing[product.product.BrandId+"/"+strings.ToLower(product.product.ModelName)] {
+			productErrors("a product with this brand and model name already exists")
+			continue
+		}
+		if !job.DryRun {
+			err := s.repo.importProduct(job.Id, &product.product, product.attributeValues, product.variants, product.imageIds)
+			if errors.Is(err, models.ErrJobStopped) {
+				return err
+			}
+			if err != nil {
+				logrus.Errorf("importCatalog: error in importing product %s of job %s err: %v", product.product.ModelName, job.Id, err)
+				productErrors("error in saving the product")
+				continue
+			}
+		}
+		job.Products++
+		job.Variants += len(product.variants)
+	}
+	return nil
+}
+
+func (s *Service) exportCatalog(job *models.CatalogJob) error {
+	variants, err := s.repo.getCatalogVariants()
+	if err != nil {
+		return err
+	}
+	brands, categories, err := s.catalogNames()
+	if err != nil {
+		return err
+	}
+	galleries, err := s.repo.getCatalogImages()
+	if err != nil {
+		return err
+	}
+	imageIds := make(map[string][]string)
+	for _, image := range galleries {
+		imageIds[image.VariantId] = append(imageIds[image.VariantId], image.ImageId)
+	}
+	values, err := s.repo.getCatalogAttributeValues()
+	if err != nil {
+		return err
+	}
+	attributes := make(map[string]models.ProductAttributes)
+	for _, value := range values {
+		if attributes[value.ProductId] == nil {
+			attributes[value.ProductId] = models.ProductAttributes{}
+		}
+		productAttributes := attributes[value.ProductId]
+		switch value.Type {
+		case models.AttributeNumber:
+			if value.NumberValue != nil {
+				productAttributes[value.Key] = *value.NumberValue
+			}
+		case models.AttributeBoolean:
+			productAttributes[value.Key], _ = strconv.ParseBool(value.TextValue)
+		case models.AttributeList:
+			items, _ := productAttributes[value.Key].([]interface{})
+			productAttributes[value.Key] = append(items, value.TextValue)
+		default:
+			productAttributes[value.Key] = value.TextValue
+		}
+	}
+
+	rows := make([]models.CatalogRow, 0, len(variants))
+	productIds := make(map[string]bool)
+	for _, variant := range variants {
+		productIds[variant.ProductId] = true
+		rows = append(rows, models.CatalogRow{
+			ProductName: variant.ProductName,
+			ModelName:   variant.ModelName,
+			Brand:       brands.labels[variant.BrandId],
+			Category:    categories.labels[variant.CategoryId],
+			Return:      variant.Return,
+			Warranty:    variant.Warranty,
+			Wireless:    variant.Wireless,
+			Colour:      variant.Colour,
+			Price:       variant.Price,
+			Stock:       variant.Stock,
+			ImageIds:    imageIds[variant.VariantId],
+			Attributes:  attributes[variant.ProductId],
+		})
+	}
+
+	job.Output, err = catalogfile.Encode(job.Format, rows)
+	job.TotalRows = len(rows)
+	job.Products = len(productIds)
+	job.Variants = len(rows)
+	return err
+}
+
+// nameIndex resolves the brands or categories catalog files refer to by name or slug.
+type nameIndex struct {
+	byName map[string][]string
+	bySlug map[string]string
+	// labels is what exports refer to them by, the name unless another one shares it
+	labels map[string]string
+}
+
+func (s *Service) catalogNames() (*nameIndex, *nameIndex, error) {
+	brands, err := s.repo.getBrandNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	categories, err := s.repo.getCategoryNames()
+	if err != nil {
+		return nil, nil, err
+	}
+	return newNameIndex(brands), newNameIndex(categories), nil
+}
+
+func newNameIndex(rows []namedRow) *nameIndex {
+	index := &nameIndex{
+		byName: make(map[string][]string, len(rows)),
+		bySlug: make(map[string]string, len(rows)),
+		labels: make(map[string]string, len(rows)),
+	}
+	for _, row := range rows {
+		name := strings.ToLower(strings.TrimSpace(row.Name))
+		index.byName[name] = append(index.byName[name], row.Id)
+		index.bySlug[row.Slug] = row.Id
+	}
+	for _, row := range rows {
+		index.labels[row.Id] = row.Name
+		if len(index.byName[strings.ToLower(strings.TrimSpace(row.Name))]) > 1 {
+			index.labels[row.Id] = row.Slug
+		}
+	}
+	return index
+}
+
+func (index *nameIndex) resolve(kind string, value string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(value))
+	if key == "" {
+		return "", fmt.Errorf("%s is required", kind)
+	}
+	if ids := index.byName[key]; len(ids) == 1 {
+		return ids[0], nil
+	}
+	if id, ok := index.bySlug[key]; ok {
+		return id, nil
+	}
+	if len(index.byName[key]) > 1 {
+		return "", fmt.Errorf("%s %q is ambiguous, use its slug", kind, value)
+	}
+	return "", fmt.Errorf("%s %q does not exist", kind, value)
+}
+
+// validateCatalogRow checks the fields of a row on their own and returns the brand and
+// category it refers to.
+func validateCatalogRow(row models.CatalogRow, brands *nameIndex, categories *nameIndex, images map[string]bool) (string, string, error) {
+	switch {
+	case row.ProductName == "":
+		return "", "", errors.New("productName is required")
+	case row.ModelName == "":
+		return "", "", errors.New("modelName is required")
+	case row.Price <= 0:
+		return "", "", errors.New("price must be positive")
+	case row.Stock < 0 || row.Return < 0 || row.Warranty < 0:
+		return "", "", errors.New("stock, return and warranty can not be negative")
+	}
+	brandId, err := brands.resolve("brand", row.Brand)
+	if err != nil {
+		return "", "", err
+	}
+	categoryId, err := categories.resolve("category", row.Category)
+	if err != nil {
+		return "", "", err
+	}
+	seen := make(map[string]bool, len(row.ImageIds))
+	for _, imageId := range row.ImageIds {
+		if !images[imageId] {
+			return "", "", fmt.Errorf("image %s does not exist", imageId)
+		}
+		if seen[imageId] {
+			return "", "", fmt.Errorf("image %s is listed twice", imageId)
+		}
+		seen[imageId] = true
+	}
+	return brandId, categoryId, nil
+}
+
+func addRowErrors(job *models.CatalogJob, rowErrors ...models.ImportRowError) {
+	job.FailedRows += len(rowErrors)
+	for _, rowError := range rowErrors {
+		if len(job.RowErrors) >= maxStoredRowErrors {
+			return
+		}
+		job.RowErrors = append(job.RowErrors, rowError)
+	}
+}
+
+// productAttributeValues checks every value against the type of its attribute and turns
+// it into the rows it is stored as.
+func productAttributeValues(attributes []models.Attribute, values models.ProductAttributes) ([]models.ProductAttributeValue, error) {
+	attributesByKey := make(map[string]models.Attribute, len(attributes))
+	for _, attribute := range attributes {
+		attributesByKey[attribute.Key] = attribute
+	}
+
+	var attributeValues []models.ProductAttributeValue
+	for key, value := range values {
+		attribute, ok := attributesByKey[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not an attribute of the product category", models.ErrInvalidAttribute, key)
+		}
+		if value == nil {
+			continue
+		}
+
+		invalidType := fmt.Errorf("%w: %q must be a %s value", models.ErrInvalidAttribute, key, attribute.Type)
+		switch attribute.Type {
+		case models.AttributeText:
+			text, ok := value.(string)
+			if !ok {
+				return nil, invalidType
+			}
+			attributeValues = append(attributeValues, models.ProductAttributeValue{AttributeId: attribute.Id, TextValue: text})
+		case models.AttributeNumber:
+			number, ok := value.(float64)
+			if !ok {
+				return nil, invalidType
+			}
+			attributeValues = append(attributeValues, models.ProductAttributeValue{
+				AttributeId: attribute.Id,
+				TextValue:   strconv.FormatFloat(number, 'f', -1, 64),
+				NumberValue: &number,
+			})
+		case models.AttributeBoolean:
+			boolean, ok := value.(bool)
+			if !ok {
+				return nil, invalidType
+			}
+			attributeValues = append(attributeValues, models.ProductAttributeValue{AttributeId: attribute.Id, TextValue: strconv.FormatBool(boolean)})
+		case models.AttributeList:
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, invalidType
+			}
+			for _, item := range items {
+				text, ok := item.(string)
+				if !ok {
+					return nil, invalidType
+				}
+				attributeValues = append(attributeValues, models.ProductAttributeValue{AttributeId: attribute.Id, TextValue: text})
+			}
+		}
+	}
+	return attributeValues, nil
+}
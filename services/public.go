@@ -9,8 +9,33 @@ type PublicService interface {
 	CheckSession(sessionID string, userID string) (time.Time, error)
 	CheckUserExist(email string) (bool, error)
 	GetUserDetails(email string) (models.Users, error)
+	GetUserById(userID string) (models.Users, error)
 	CreateUser(email string, password string) (string, error)
 	CreateUserRole(userID string, role models.Roles) (string, error)
 	GetSessionId(userID string) (string, error)
 	Logout(userID string, sessionID string) error
+	CreatePasswordResetToken(userID string) (string, error)
+	CheckPasswordResetToken(token string) error
+	ResetPassword(token string, hashedPassword string) error
+	ConfirmEmailChange(token string) error
+	LoginLockedUntil(email string, ip string) (time.Time, error)
+	RecordLoginFailure(email string, ip string) error
+	ResetLoginFailures(email string) error
+	CreateOidcLoginState(provider string) (models.OidcLoginState, error)
+	ConsumeOidcLoginState(state string) (models.OidcLoginState, error)
+	LinkOidcIdentity(provider string, subject string, email string, emailVerified bool) (string, error)
+	HasRole(userID string, role models.Roles) (bool, error)
+	CreateLoginChallenge(userID string, role models.Roles) (string, time.Time, error)
+	GetLoginChallenge(token string) (models.LoginChallenge, error)
+	UseLoginChallengeAttempt(challengeID string) error
+	TwoFactorLockedUntil(userID string) (time.Time, error)
+	RecordTwoFactorFailure(userID string) error
+	ResetTwoFactorFailures(userID string) error
+	CompleteLoginChallenge(challengeID string) error
+	GetUserTotp(userID string) (models.UserTotp, error)
+	StartTotpEnrollment(userID string) (string, error)
+	VerifyTotpCode(userID string, code string) error
+	EnableTotp(userID string) ([]string, error)
+	UseRecoveryCode(userID string, code string) error
+	RegenerateRecoveryCodes(userID string) ([]string, error)
 }
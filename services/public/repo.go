@@ -1,11 +1,13 @@
 package public
 
 import (
+	"database/sql"
 	"errors"
 	"github.com/Shresth92/audiophile/internal"
 	"github.com/Shresth92/audiophile/models"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
@@ -53,6 +55,16 @@ func (r *repository) getUserDetails(email string) (models.Users, error) {
 	return user, err
 }
 
+func (r *repository) getUserById(userId string) (models.Users, error) {
+	user := models.Users{}
+	err := r.Database.DB.
+		Model(&models.Users{}).
+		Where("id = ? AND archived_at is null", userId).
+		First(&user).
+		Error
+	return user, err
+}
+
 func (r *repository) createUser(email string, password string) (string, error) {
 	userId := uuid.New().String()
 	user := models.Users{
@@ -103,3 +115,409 @@ func (r *repository) logout(userID string, sessionId string) error {
 		Error
 	return err
 }
+
+func (r *repository) createUserToken(userId string, purpose models.TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	tokenId := uuid.New().String()
+	token := models.UserToken{
+		Id:        tokenId,
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+	err := r.Database.DB.
+		Model(&models.UserToken{}).
+		Create(&token).
+		Error
+	return err
+}
+
+func (r *repository) userTokenValid(tokenHash string, purpose models.TokenPurpose) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(&models.UserToken{}).
+		Where("token_hash = ? AND purpose = ? AND used_at is null AND expires_at > ?", tokenHash, purpose, time.Now()).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+func consumeUserToken(tx *gorm.DB, tokenHash string, purpose models.TokenPurpose) (models.UserToken, error) {
+	token := models.UserToken{}
+	result := tx.
+		Model(&token).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND used_at is null AND expires_at > ?", tokenHash, purpose, time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return token, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return token, models.ErrInvalidToken
+	}
+	return token, nil
+}
+
+func (r *repository) resetPassword(tokenHash string, hashedPassword string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, tokenHash, models.PasswordReset)
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(&models.Users{}).
+			Where("id = ? AND archived_at is null", token.UserId).
+			Updates(map[string]interface{}{"password": hashedPassword, "updated_at": time.Now()}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&models.Session{}).
+			Where("user_id = ? AND ended_at > ?", token.UserId, time.Now()).
+			Update("ended_at", time.Now()).
+			Error
+	})
+}
+
+func (r *repository) getLoginLockedUntil(keys []string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := r.Database.DB.
+		Model(&models.LoginThrottle{}).
+		Select("max(locked_until)").
+		Where("key IN ? AND locked_until > ?", keys, time.Now()).
+		Row().
+		Scan(&lockedUntil)
+	return lockedUntil.Time, err
+}
+
+func (r *repository) recordLoginFailure(key string, failureWindow time.Duration) (int, error) {
+	var failures int
+	err := r.Database.DB.
+		Raw(`INSERT INTO login_throttles (key, failures, last_failed_at) VALUES (?, 1, ?)
+			ON CONFLICT (key) DO UPDATE SET
+				failures = CASE WHEN login_throttles.last_failed_at < ? THEN 1 ELSE login_throttles.failures + 1 END,
+				last_failed_at = excluded.last_failed_at
+			RETURNING failures`, key, time.Now(), time.Now().Add(-failureWindow)).
+		Scan(&failures).
+		Error
+	return failures, err
+}
+
+func (r *repository) lockLogin(key string, lockedUntil time.Time) error {
+	err := r.Database.DB.
+		Model(&models.LoginThrottle{}).
+		Where("key = ?", key).
+		Update("locked_until", lockedUntil).
+		Error
+	return err
+}
+
+func (r *repository) resetLoginFailures(key string) error {
+	err := r.Database.DB.
+		Where("key = ?", key).
+		Delete(&models.LoginThrottle{}).
+		Error
+	return err
+}
+
+func (r *repository) confirmEmailChange(tokenHash string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := consumeUserToken(tx, tokenHash, models.EmailChange)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.
+			Model(&models.Users{}).
+			Where("email = ? AND id <> ? AND archived_at is null", token.Payload, token.UserId).
+			Count(&count).
+			Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return models.ErrEmailTaken
+		}
+
+		return tx.
+			Model(&models.Users{}).
+			Where("id = ? AND archived_at is null", token.UserId).
+			Updates(map[string]interface{}{"email": token.Payload, "updated_at": time.Now()}).
+			Error
+	})
+}
+
+func (r *repository) createOidcLoginState(loginState *models.OidcLoginState) error {
+	// abandoned logins are cleaned up here instead of by a separate job
+	err := r.Database.DB.
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.OidcLoginState{}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	err = r.Database.DB.
+		Model(&models.OidcLoginState{}).
+		Create(loginState).
+		Error
+	return err
+}
+
+func (r *repository) consumeOidcLoginState(state string) (models.OidcLoginState, error) {
+	loginState := models.OidcLoginState{}
+	result := r.Database.DB.
+		Clauses(clause.Returning{}).
+		Where("state = ? AND expires_at > ?", state, time.Now()).
+		Delete(&loginState)
+	if result.Error != nil {
+		return loginState, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return loginState, models.ErrInvalidToken
+	}
+	return loginState, nil
+}
+
+func (r *repository) linkIdentity(provider string, subject string, email string, emailVerified bool) (string, error) {
+	var userId string
+	err := r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		identity := models.UserIdentity{}
+		err := tx.
+			Model(&models.UserIdentity{}).
+			Joins("join users u on u.id = user_identities.user_id and u.archived_at is null").
+			Where("user_identities.provider = ? AND user_identities.subject = ? AND user_identities.archived_at is null", provider, subject).
+			First(&identity).
+			Error
+		if err == nil {
+			userId = identity.UserId
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		user := models.Users{}
+		if email != "" {
+			err = tx.
+				Model(&models.Users{}).
+				Where("email = ? AND archived_at is null", email).
+				First(&user).
+				Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		if user.Id != "" {
+			// only a provider verified email may be attached to an existing account,
+			// anything else would allow taking over that account
+			if !emailVerified {
+				return models.ErrIdentityConflict
+			}
+		} else {
+			user = models.Users{Id: uuid.New().String()}
+			// an unverified email is left off the account, so it can not claim the address
+			// before its owner signs up
+			if emailVerified {
+				user.Email = email
+			}
+			if err := tx.Model(&models.Users{}).Create(&user).Error; err != nil {
+				return err
+			}
+
+			role := models.UserRole{
+				Id:     uuid.New().String(),
+				UserId: user.Id,
+				Role:   models.User,
+			}
+			if err := tx.Model(&models.UserRole{}).Create(&role).Error; err != nil {
+				return err
+			}
+		}
+
+		identity = models.UserIdentity{
+			Id:       uuid.New().String(),
+			UserId:   user.Id,
+			Provider: provider,
+			Subject:  subject,
+			Email:    email,
+		}
+		if err := tx.Model(&models.UserIdentity{}).Create(&identity).Error; err != nil {
+			return err
+		}
+
+		userId = user.Id
+		return nil
+	})
+	return userId, err
+}
+
+func (r *repository) hasRole(userId string, role models.Roles) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(&models.UserRole{}).
+		Where("user_id = ? AND role = ? AND archived_at is null", userId, role).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+func (r *repository) createLoginChallenge(challenge *models.LoginChallenge) error {
+	err := r.Database.DB.
+		Model(&models.LoginChallenge{}).
+		Create(challenge).
+		Error
+	return err
+}
+
+func (r *repository) getLoginChallenge(tokenHash string, maxAttempts int) (models.LoginChallenge, error) {
+	challenge := models.LoginChallenge{}
+	err := r.Database.DB.
+		Model(&models.LoginChallenge{}).
+		Where("token_hash = ? AND used_at is null AND expires_at > ? AND attempts < ?", tokenHash, time.Now(), maxAttempts).
+		First(&challenge).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return challenge, models.ErrInvalidToken
+	}
+	return challenge, err
+}
+
+// useLoginChallengeAttempt counts an attempt in the same statement that checks the limit,
+// so parallel requests can not get past it.
+func (r *repository) useLoginChallengeAttempt(challengeId string, maxAttempts int) error {
+	result := r.Database.DB.
+		Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at is null AND expires_at > ? AND attempts < ?", challengeId, time.Now(), maxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + ?", 1))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrInvalidToken
+	}
+	return nil
+}
+
+func (r *repository) completeLoginChallenge(challengeId string) error {
+	result := r.Database.DB.
+		Model(&models.LoginChallenge{}).
+		Where("id = ? AND used_at is null", challengeId).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrInvalidToken
+	}
+	return nil
+}
+
+func (r *repository) getUserTotp(userId string) (models.UserTotp, error) {
+	totp := models.UserTotp{}
+	err := r.Database.DB.
+		Model(&models.UserTotp{}).
+		Where("user_id = ?", userId).
+		First(&totp).
+		Error
+	return totp, err
+}
+
+func (r *repository) saveTotpSecret(userId string, secret string) error {
+	totp := models.UserTotp{
+		Id:     uuid.New().String(),
+		UserId: userId,
+		Secret: secret,
+	}
+	err := r.Database.DB.
+		Model(&models.UserTotp{}).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"secret":         secret,
+				"last_used_step": 0,
+				"updated_at":     time.Now(),
+			}),
+			// an enrolled secret is never replaced by a new enrollment
+			Where: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_totps.enabled_at is null"}}},
+		}).
+		Create(&totp).
+		Error
+	return err
+}
+
+func (r *repository) useTotpStep(totpId string, step int64) error {
+	result := r.Database.DB.
+		Model(&models.UserTotp{}).
+		Where("id = ? AND last_used_step < ?", totpId, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrInvalidTotpCode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId string, codeHashes []string) error {
+	err := tx.
+		Where("user_id = ?", userId).
+		Delete(&models.RecoveryCode{}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	recoveryCodes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		recoveryCodes = append(recoveryCodes, models.RecoveryCode{
+			Id:       uuid.New().String(),
+			UserId:   userId,
+			CodeHash: codeHash,
+		})
+	}
+	return tx.
+		Model(&models.RecoveryCode{}).
+		Create(&recoveryCodes).
+		Error
+}
+
+func (r *repository) enableTotp(userId string, codeHashes []string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Model(&models.UserTotp{}).
+			Where("user_id = ? AND enabled_at is null", userId).
+			Updates(map[string]interface{}{"enabled_at": time.Now(), "updated_at": time.Now()}).
+			Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func (r *repository) replaceRecoveryCodes(userId string, codeHashes []string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+}
+
+func (r *repository) useRecoveryCode(userId string, codeHash string) error {
+	result := r.Database.DB.
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at is null", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.ErrInvalidTotpCode
+	}
+	return nil
+}
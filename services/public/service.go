@@ -3,9 +3,59 @@ package public
 import (
 	"github.com/Shresth92/audiophile/internal"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/google/uuid"
+	"strings"
 	"time"
 )
 
+const (
+	passwordResetValidity  = 30 * time.Minute
+	oidcLoginValidity      = 10 * time.Minute
+	loginChallengeValidity = 5 * time.Minute
+	loginChallengeAttempts = 5
+	recoveryCodeCount      = 10
+)
+
+// loginPolicy describes how failed logins for a single key are throttled. The
+// first freeAttempts failures are not delayed, every failure after that doubles
+// the lockout starting at one second until it reaches maxLockout.
+type loginPolicy struct {
+	prefix       string
+	freeAttempts int
+	maxLockout   time.Duration
+}
+
+var (
+	accountLoginPolicy = loginPolicy{prefix: "account:", freeAttempts: 5, maxLockout: 30 * time.Minute}
+	ipLoginPolicy      = loginPolicy{prefix: "ip:", freeAttempts: 20, maxLockout: 30 * time.Minute}
+	// twoFactorLoginPolicy throttles wrong two factor codes of an account across all of its
+	// login challenges
+	twoFactorLoginPolicy = loginPolicy{prefix: "totp:", freeAttempts: 5, maxLockout: 30 * time.Minute}
+)
+
+// failures older than loginFailureWindow are forgotten on the next failure
+const loginFailureWindow = 24 * time.Hour
+
+func (p loginPolicy) key(value string) string {
+	return p.prefix + strings.ToLower(value)
+}
+
+func (p loginPolicy) lockout(failures int) time.Duration {
+	exceeded := failures - p.freeAttempts
+	if exceeded <= 0 {
+		return 0
+	}
+	if exceeded > 30 {
+		return p.maxLockout
+	}
+	lockout := time.Duration(1<<(exceeded-1)) * time.Second
+	if lockout > p.maxLockout {
+		return p.maxLockout
+	}
+	return lockout
+}
+
 type Service struct {
 	repo *repository
 }
@@ -26,6 +76,10 @@ func (s *Service) GetUserDetails(email string) (models.Users, error) {
 	return s.repo.getUserDetails(email)
 }
 
+func (s *Service) GetUserById(userID string) (models.Users, error) {
+	return s.repo.getUserById(userID)
+}
+
 func (s *Service) CreateUser(email string, password string) (string, error) {
 	return s.repo.createUser(email, password)
 }
@@ -41,3 +95,193 @@ func (s *Service) GetSessionId(userID string) (string, error) {
 func (s *Service) Logout(userID string, sessionID string) error {
 	return s.repo.logout(userID, sessionID)
 }
+
+func (s *Service) CreatePasswordResetToken(userID string) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.createUserToken(userID, models.PasswordReset, utils.HashToken(token), time.Now().Add(passwordResetValidity))
+	return token, err
+}
+
+// CheckPasswordResetToken fails with ErrInvalidToken unless the token can still be used,
+// ResetPassword checks it again when consuming it.
+func (s *Service) CheckPasswordResetToken(token string) error {
+	valid, err := s.repo.userTokenValid(utils.HashToken(token), models.PasswordReset)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return models.ErrInvalidToken
+	}
+	return nil
+}
+
+func (s *Service) ResetPassword(token string, hashedPassword string) error {
+	return s.repo.resetPassword(utils.HashToken(token), hashedPassword)
+}
+
+func (s *Service) LoginLockedUntil(email string, ip string) (time.Time, error) {
+	return s.repo.getLoginLockedUntil([]string{accountLoginPolicy.key(email), ipLoginPolicy.key(ip)})
+}
+
+func (s *Service) RecordLoginFailure(email string, ip string) error {
+	for policy, value := range map[loginPolicy]string{accountLoginPolicy: email, ipLoginPolicy: ip} {
+		if err := s.recordFailure(policy, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) ResetLoginFailures(email string) error {
+	return s.repo.resetLoginFailures(accountLoginPolicy.key(email))
+}
+
+func (s *Service) TwoFactorLockedUntil(userID string) (time.Time, error) {
+	return s.repo.getLoginLockedUntil([]string{twoFactorLoginPolicy.key(userID)})
+}
+
+func (s *Service) RecordTwoFactorFailure(userID string) error {
+	return s.recordFailure(twoFactorLoginPolicy, userID)
+}
+
+func (s *Service) ResetTwoFactorFailures(userID string) error {
+	return s.repo.resetLoginFailures(twoFactorLoginPolicy.key(userID))
+}
+
+func (s *Service) recordFailure(policy loginPolicy, value string) error {
+	key := policy.key(value)
+	failures, err := s.repo.recordLoginFailure(key, loginFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if lockout := policy.lockout(failures); lockout > 0 {
+		return s.repo.lockLogin(key, time.Now().Add(lockout))
+	}
+	return nil
+}
+
+func (s *Service) ConfirmEmailChange(token string) error {
+	return s.repo.confirmEmailChange(utils.HashToken(token))
+}
+
+func (s *Service) CreateOidcLoginState(provider string) (models.OidcLoginState, error) {
+	loginState := models.OidcLoginState{
+		Provider:  provider,
+		ExpiresAt: time.Now().Add(oidcLoginValidity),
+	}
+
+	var err error
+	for _, value := range []*string{&loginState.State, &loginState.Nonce, &loginState.CodeVerifier} {
+		if *value, err = utils.GenerateRandomToken(); err != nil {
+			return loginState, err
+		}
+	}
+
+	err = s.repo.createOidcLoginState(&loginState)
+	return loginState, err
+}
+
+func (s *Service) ConsumeOidcLoginState(state string) (models.OidcLoginState, error) {
+	return s.repo.consumeOidcLoginState(state)
+}
+
+func (s *Service) LinkOidcIdentity(provider string, subject string, email string, emailVerified bool) (string, error) {
+	return s.repo.linkIdentity(provider, subject, email, emailVerified)
+}
+
+func (s *Service) HasRole(userID string, role models.Roles) (bool, error) {
+	return s.repo.hasRole(userID, role)
+}
+
+func (s *Service) CreateLoginChallenge(userID string, role models.Roles) (string, time.Time, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	challenge := models.LoginChallenge{
+		Id:        uuid.New().String(),
+		UserId:    userID,
+		TokenHash: utils.HashToken(token),
+		Role:      role,
+		ExpiresAt: time.Now().Add(loginChallengeValidity),
+	}
+	err = s.repo.createLoginChallenge(&challenge)
+	return token, challenge.ExpiresAt, err
+}
+
+func (s *Service) GetLoginChallenge(token string) (models.LoginChallenge, error) {
+	return s.repo.getLoginChallenge(utils.HashToken(token), loginChallengeAttempts)
+}
+
+// UseLoginChallengeAttempt takes one of the attempts of the challenge before a code is
+// checked, it fails with ErrInvalidToken once they are used up.
+func (s *Service) UseLoginChallengeAttempt(challengeID string) error {
+	return s.repo.useLoginChallengeAttempt(challengeID, loginChallengeAttempts)
+}
+
+func (s *Service) CompleteLoginChallenge(challengeID string) error {
+	return s.repo.completeLoginChallenge(challengeID)
+}
+
+func (s *Service) GetUserTotp(userID string) (models.UserTotp, error) {
+	return s.repo.getUserTotp(userID)
+}
+
+func (s *Service) StartTotpEnrollment(userID string) (string, error) {
+	secret, err := utils.GenerateTotpSecret()
+	if err != nil {
+		return "", err
+	}
+	return secret, s.repo.saveTotpSecret(userID, secret)
+}
+
+func (s *Service) VerifyTotpCode(userID string, code string) error {
+	totp, err := s.repo.getUserTotp(userID)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utils.ValidateTotp(totp.Secret, code, time.Now())
+	if !ok {
+		return models.ErrInvalidTotpCode
+	}
+	return s.repo.useTotpStep(totp.Id, step)
+}
+
+func (s *Service) EnableTotp(userID string) ([]string, error) {
+	codes, codeHashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, s.repo.enableTotp(userID, codeHashes)
+}
+
+func (s *Service) UseRecoveryCode(userID string, code string) error {
+	return s.repo.useRecoveryCode(userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+}
+
+func (s *Service) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	codes, codeHashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	return codes, s.repo.replaceRecoveryCodes(userID, codeHashes)
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codeHashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		codeHashes = append(codeHashes, utils.HashToken(code))
+	}
+	return codes, codeHashes, nil
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+)
+
+type QuestionServices interface {
+	AskQuestion(userId string, productId string, body *models.QuestionBody) (string, error)
+	AnswerQuestion(userId string, questionId string, body *models.AnswerBody, byAdmin bool) (string, error)
+	GetProductQuestions(productId string, params *pagination.Params) ([]models.ProductQuestion, error)
+	CountProductQuestions(productId string) (int64, error)
+	GetQuestions(unanswered bool, params *pagination.Params) ([]models.ProductQuestion, error)
+	CountQuestions(unanswered bool) (int64, error)
+	SetQuestionHidden(questionId string, hidden bool) error
+	SetAnswerHidden(answerId string, hidden bool) error
+}
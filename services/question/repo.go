@@ -0,0 +1,145 @@
+package question
+
+import (
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"gorm.io/gorm"
+	"time"
+)
+
+var questionSortColumns = pagination.Columns{
+	pagination.SortNewest: {Expr: "q.created_at", Type: pagination.Timestamp},
+}
+
+type repository struct {
+	*internal.Database
+}
+
+func newQuestionRepository(db *internal.Database) *repository {
+	return &repository{Database: db}
+}
+
+// productExists reports whether the product is published, shoppers can not ask about drafts.
+func (r *repository) productExists(productId string) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(&models.Product{}).
+		Where("id = ? and status = ? and archived_at is null", productId, models.ProductPublished).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// questionProduct returns the product of a question that has not been hidden.
+func (r *repository) questionProduct(questionId string) (string, error) {
+	question := models.Question{}
+	err := r.Database.DB.
+		Model(&models.Question{}).
+		Where("id = ? and hidden = false and archived_at is null", questionId).
+		First(&question).
+		Error
+	return question.ProductId, err
+}
+
+// receivedProduct reports whether one of the delivered orders of the user contains a
+// variant of the product.
+func (r *repository) receivedProduct(userId string, productId string) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Table("product_ordereds po").
+		Joins("join orders o on o.id = po.order_id").
+		Joins("join variants v on v.id = po.variant_id").
+		Where("o.user_id = ? and o.delivery_status = ? and v.product_id = ? and po.archived_at is null", userId, models.Delivered, productId).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+func (r *repository) createQuestion(question *models.Question) error {
+	return r.Database.DB.Create(question).Error
+}
+
+func (r *repository) createAnswer(answer *models.Answer) error {
+	return r.Database.DB.Create(answer).Error
+}
+
+// questionListing selects the questions of productId, or of every product when it is
+// empty. Hidden questions and questions without answers are only listed when asked for.
+func (r *repository) questionListing(productId string, withHidden bool, unanswered bool) *gorm.DB {
+	query := r.Database.DB.
+		Table("questions q").
+		Where("q.archived_at is null")
+	if productId != "" {
+		query = query.Where("q.product_id = ?", productId)
+	}
+	if !withHidden {
+		query = query.Where("q.hidden = false")
+	}
+	if unanswered {
+		query = query.Where("not exists (select 1 from answers a where a.question_id = q.id and a.archived_at is null and a.hidden = false)")
+	}
+	return query
+}
+
+func (r *repository) getQuestions(productId string, withHidden bool, unanswered bool, params *pagination.Params) ([]models.ProductQuestion, error) {
+	questionIds, err := params.Keys(r.questionListing(productId, withHidden, unanswered), "q.id", questionSortColumns)
+	if err != nil || len(questionIds) == 0 {
+		return []models.ProductQuestion{}, err
+	}
+
+	questions := make([]models.ProductQuestion, 0, len(questionIds))
+	err = r.Database.DB.
+		Table("questions q").
+		Select("q.id, q.product_id, coalesce(u.name, '') as author, q.body, q.hidden, q.created_at").
+		Joins("join users u on u.id = q.user_id").
+		Where("q.id IN ?", questionIds).
+		Scan(&questions).
+		Error
+	pagination.Reorder(questionIds, questions, func(question models.ProductQuestion) string { return question.Id })
+	return questions, err
+}
+
+func (r *repository) countQuestions(productId string, withHidden bool, unanswered bool) (int64, error) {
+	var count int64
+	err := r.questionListing(productId, withHidden, unanswered).
+		Count(&count).
+		Error
+	return count, err
+}
+
+// getAnswers returns the answers of the questions, admin answers first and then oldest first.
+func (r *repository) getAnswers(questionIds []string, withHidden bool) ([]models.ProductAnswer, error) {
+	var answers []models.ProductAnswer
+	query := r.Database.DB.
+		Table("answers a").
+		Select("a.id, a.question_id, coalesce(u.name, '') as author, a.body, a.by_admin, a.verified_buyer, a.hidden, a.created_at").
+		Joins("join users u on u.id = a.user_id").
+		Where("a.question_id IN ? and a.archived_at is null", questionIds)
+	if !withHidden {
+		query = query.Where("a.hidden = false")
+	}
+	err := query.
+		Order("a.by_admin desc, a.created_at, a.id").
+		Scan(&answers).
+		Error
+	return answers, err
+}
+
+// setHidden hides or shows again a question or an answer.
+func (r *repository) setHidden(model interface{}, id string, hidden bool) error {
+	result := r.Database.DB.
+		Model(model).
+		Where("id = ? and archived_at is null", id).
+		Updates(map[string]interface{}{
+			"hidden":     hidden,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package question
+
+import (
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"github.com/google/uuid"
+)
+
+type Service struct {
+	repo *repository
+}
+
+func NewQuestionService(db *internal.Database) *Service {
+	return &Service{repo: newQuestionRepository(db)}
+}
+
+func (s *Service) AskQuestion(userId string, productId string, body *models.QuestionBody) (string, error) {
+	exists, err := s.repo.productExists(productId)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", models.ErrProductNotFound
+	}
+
+	question := models.Question{
+		Id:        uuid.New().String(),
+		ProductId: productId,
+		UserId:    userId,
+		Body:      body.Body,
+	}
+	if err := s.repo.createQuestion(&question); err != nil {
+		return "", err
+	}
+	return question.Id, nil
+}
+
+// AnswerQuestion lets admins answer any question and users only questions about products
+// they received.
+func (s *Service) AnswerQuestion(userId string, questionId string, body *models.AnswerBody, byAdmin bool) (string, error) {
+	productId, err := s.repo.questionProduct(questionId)
+	if err != nil {
+		return "", err
+	}
+
+	verifiedBuyer := false
+	if !byAdmin {
+		if verifiedBuyer, err = s.repo.receivedProduct(userId, productId); err != nil {
+			return "", err
+		}
+		if !verifiedBuyer {
+			return "", models.ErrNotProductBuyer
+		}
+	}
+
+	answer := models.Answer{
+		Id:            uuid.New().String(),
+		QuestionId:    questionId,
+		UserId:        userId,
+		Body:          body.Body,
+		ByAdmin:       byAdmin,
+		VerifiedBuyer: verifiedBuyer,
+	}
+	if err := s.repo.createAnswer(&answer); err != nil {
+		return "", err
+	}
+	return answer.Id, nil
+}
+
+func (s *Service) GetProductQuestions(productId string, params *pagination.Params) ([]models.ProductQuestion, error) {
+	return s.questions(productId, false, false, params)
+}
+
+func (s *Service) CountProductQuestions(productId string) (int64, error) {
+	return s.repo.countQuestions(productId, false, false)
+}
+
+// GetQuestions lists the questions of all products for moderation, hidden ones included.
+func (s *Service) GetQuestions(unanswered bool, params *pagination.Params) ([]models.ProductQuestion, error) {
+	return s.questions("", true, unanswered, params)
+}
+
+func (s *Service) CountQuestions(unanswered bool) (int64, error) {
+	return s.repo.countQuestions("", true, unanswered)
+}
+
+func (s *Service) SetQuestionHidden(questionId string, hidden bool) error {
+	return s.repo.setHidden(&models.Question{}, questionId, hidden)
+}
+
+func (s *Service) SetAnswerHidden(answerId string, hidden bool) error {
+	return s.repo.setHidden(&models.Answer{}, answerId, hidden)
+}
+
+func (s *Service) questions(productId string, withHidden bool, unanswered bool, params *pagination.Params) ([]models.ProductQuestion, error) {
+	questions, err := s.repo.getQuestions(productId, withHidden, unanswered, params)
+	if err != nil || len(questions) == 0 {
+		return questions, err
+	}
+
+	questionIds := make([]string, 0, len(questions))
+	questionIndex := make(map[string]int, len(questions))
+	for i := range questions {
+		questions[i].Answers = []models.ProductAnswer{}
+		questionIds = append(questionIds, questions[i].Id)
+		questionIndex[questions[i].Id] = i
+	}
+
+	answers, err := s.repo.getAnswers(questionIds, withHidden)
+	if err != nil {
+		return nil, err
+	}
+	for _, answer := range answers {
+		question := &questions[questionIndex[answer.QuestionId]]
+		question.Answers = append(question.Answers, answer)
+	}
+	return questions, nil
+}
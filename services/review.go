@@ -0,0 +1,20 @@
+package services
+
+import (
+	"context"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+)
+
+type ReviewServices interface {
+	UploadReviewPhoto(ctx context.Context, userId string, data []byte) (models.Images, []models.ImageRendition, error)
+	CreateReview(userId string, body *models.ReviewBody) (string, error)
+	GetProductReviews(productId string, params *pagination.Params) ([]models.ProductReview, error)
+	CountProductReviews(productId string) (int64, error)
+	GetReviewsByStatus(status models.ReviewStatus, params *pagination.Params) ([]models.ProductReview, error)
+	CountReviewsByStatus(status models.ReviewStatus) (int64, error)
+	ModerateReview(reviewId string, status models.ReviewStatus) error
+	AddHelpfulVote(reviewId string, userId string) error
+	RemoveHelpfulVote(reviewId string, userId string) error
+	ReviewSummaries(productIds []string) (map[string]models.ReviewSummary, error)
+}
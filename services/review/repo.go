@@ -0,0 +1,261 @@
+package review
+
+import (
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+const helpfulCount = "(select count(*) from review_votes rv where rv.review_id = r.id)"
+
+var reviewSortColumns = pagination.Columns{
+	pagination.SortNewest:  {Expr: "r.created_at", Type: pagination.Timestamp},
+	pagination.SortRating:  {Expr: "r.rating", Type: pagination.Integer},
+	pagination.SortHelpful: {Expr: helpfulCount, Type: pagination.Integer},
+}
+
+type reviewImageRow struct {
+	ReviewId   string
+	BucketName string
+	Path       string
+}
+
+type repository struct {
+	*internal.Database
+}
+
+func newReviewRepository(db *internal.Database) *repository {
+	return &repository{Database: db}
+}
+
+// deliveredVariantProduct returns the product of the variant when one of the delivered
+// orders of the user contains it.
+func (r *repository) deliveredVariantProduct(userId string, variantId string) (string, error) {
+	var productIds []string
+	err := r.Database.DB.
+		Table("product_ordereds po").
+		Joins("join orders o on o.id = po.order_id").
+		Joins("join variants v on v.id = po.variant_id").
+		Where("o.user_id = ? and o.delivery_status = ? and po.variant_id = ? and po.archived_at is null", userId, models.Delivered, variantId).
+		Limit(1).
+		Pluck("v.product_id", &productIds).
+		Error
+	if err != nil {
+		return "", err
+	}
+	if len(productIds) == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return productIds[0], nil
+}
+
+func (r *repository) reviewExists(userId string, variantId string) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(&models.Review{}).
+		Where("user_id = ? and variant_id = ? and archived_at is null", userId, variantId).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// unattachedPhotoCount counts the photos of the user that are not part of a review yet.
+func unattachedPhotoCount(db *gorm.DB, userId string) (int64, error) {
+	var count int64
+	err := db.
+		Model(&models.Images{}).
+		Where("uploaded_by = ? and archived_at is null", userId).
+		Where("NOT EXISTS (SELECT 1 FROM review_images ri WHERE ri.image_id = images.id)").
+		Count(&count).
+		Error
+	return count, err
+}
+
+func (r *repository) countUnattachedPhotos(userId string) (int64, error) {
+	return unattachedPhotoCount(r.Database.DB, userId)
+}
+
+// createReviewPhoto saves a photo of the user, it fails with ErrTooManyPhotos when the
+// user already has limit photos that are not part of a review. The user row is locked
+// so parallel uploads can not get past the limit.
+func (r *repository) createReviewPhoto(image *models.Images, renditions []models.ImageRendition, limit int64) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		user := models.Users{}
+		err := tx.Model(&models.Users{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id").
+			Where("id = ?", image.UploadedBy).
+			First(&user).
+			Error
+		if err != nil {
+			return err
+		}
+		count, err := unattachedPhotoCount(tx, image.UploadedBy)
+		if err != nil {
+			return err
+		}
+		if count >= limit {
+			return models.ErrTooManyPhotos
+		}
+
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		if len(renditions) == 0 {
+			return nil
+		}
+		return tx.Create(&renditions).Error
+	})
+}
+
+// createReview fails with ErrInvalidPhotos unless every image was uploaded by the author of
+// the review and is attached nowhere yet. The images stay locked until the review is saved
+// so two reviews can not claim the same photo.
+func (r *repository) createReview(review *models.Review, imageIds []string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		if len(imageIds) > 0 {
+			var available []string
+			err := tx.Model(&models.Images{}).
+				Where("id IN ? and uploaded_by = ? and archived_at is null", imageIds, review.UserId).
+				Where("NOT EXISTS (SELECT 1 FROM variant_images vi WHERE vi.image_id = images.id AND vi.archived_at IS NULL)").
+				Where("NOT EXISTS (SELECT 1 FROM review_images ri WHERE ri.image_id = images.id)").
+				Clauses(clause.Locking{Strength: "UPDATE"}).
+				Pluck("id", &available).
+				Error
+			if err != nil {
+				return err
+			}
+			if len(available) != len(imageIds) {
+				return models.ErrInvalidPhotos
+			}
+		}
+
+		if err := tx.Create(review).Error; err != nil {
+			return err
+		}
+		if len(imageIds) == 0 {
+			return nil
+		}
+
+		images := make([]models.ReviewImage, 0, len(imageIds))
+		for _, imageId := range imageIds {
+			images = append(images, models.ReviewImage{
+				Id:       uuid.New().String(),
+				ReviewId: review.Id,
+				ImageId:  imageId,
+			})
+		}
+		return tx.Create(&images).Error
+	})
+}
+
+// reviewListing selects the active reviews in status, of productId unless it is empty.
+func (r *repository) reviewListing(productId string, status models.ReviewStatus) *gorm.DB {
+	query := r.Database.DB.
+		Table("reviews r").
+		Where("r.archived_at is null and r.status = ?", status)
+	if productId != "" {
+		query = query.Where("r.product_id = ?", productId)
+	}
+	return query
+}
+
+func (r *repository) getReviews(productId string, status models.ReviewStatus, params *pagination.Params) ([]models.ProductReview, error) {
+	reviewIds, err := params.Keys(r.reviewListing(productId, status), "r.id", reviewSortColumns)
+	if err != nil || len(reviewIds) == 0 {
+		return []models.ProductReview{}, err
+	}
+
+	reviews := make([]models.ProductReview, 0, len(reviewIds))
+	err = r.Database.DB.
+		Table("reviews r").
+		Select("r.id, r.product_id, r.variant_id, v.colour, coalesce(u.name, '') as author, r.rating, r.title, r.body, r.status, r.created_at, "+helpfulCount+" as helpful_count").
+		Joins("join variants v on v.id = r.variant_id").
+		Joins("join users u on u.id = r.user_id").
+		Where("r.id IN ?", reviewIds).
+		Scan(&reviews).
+		Error
+	pagination.Reorder(reviewIds, reviews, func(review models.ProductReview) string { return review.Id })
+	return reviews, err
+}
+
+func (r *repository) countReviews(productId string, status models.ReviewStatus) (int64, error) {
+	var count int64
+	err := r.reviewListing(productId, status).
+		Count(&count).
+		Error
+	return count, err
+}
+
+func (r *repository) getReviewImages(reviewIds []string) ([]reviewImageRow, error) {
+	var rows []reviewImageRow
+	err := r.Database.DB.
+		Table("review_images ri").
+		Select("ri.review_id, i.bucket_name, i.path").
+		Joins("join images i on i.id = ri.image_id and i.archived_at is null").
+		Where("ri.review_id IN ?", reviewIds).
+		Order("i.created_at, i.id").
+		Scan(&rows).
+		Error
+	return rows, err
+}
+
+func (r *repository) updateReviewStatus(reviewId string, status models.ReviewStatus) error {
+	result := r.Database.DB.
+		Model(&models.Review{}).
+		Where("id = ? and archived_at is null", reviewId).
+		Updates(map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// addVote records the vote once, voting again for the same review changes nothing.
+func (r *repository) addVote(reviewId string, userId string) error {
+	var count int64
+	err := r.reviewListing("", models.ReviewApproved).
+		Where("r.id = ?", reviewId).
+		Count(&count).
+		Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return r.Database.DB.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.ReviewVote{ReviewId: reviewId, UserId: userId}).
+		Error
+}
+
+func (r *repository) removeVote(reviewId string, userId string) error {
+	return r.Database.DB.
+		Where("review_id = ? and user_id = ?", reviewId, userId).
+		Delete(&models.ReviewVote{}).
+		Error
+}
+
+func (r *repository) getReviewSummaries(productIds []string) ([]models.ReviewSummary, error) {
+	var summaries []models.ReviewSummary
+	err := r.Database.DB.
+		Model(&models.Review{}).
+		Select("product_id, round(avg(rating), 2)::float8 as average_rating, count(*) as review_count").
+		Where("product_id IN ? and status = ? and archived_at is null", productIds, models.ReviewApproved).
+		Group("product_id").
+		Scan(&summaries).
+		Error
+	return summaries, err
+}
@@ -0,0 +1,166 @@
+package review
+
+import (
+	"context"
+	"errors"
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/internal/storage"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxUnattachedPhotos caps the photos a user uploaded that are not part of a review yet,
+// they are removed by the orphan image cleanup a day after their upload.
+const maxUnattachedPhotos = 10
+
+type Service struct {
+	repo      *repository
+	store     storage.ObjectStore
+	imageURLs *storage.ImageURLService
+}
+
+func NewReviewService(db *internal.Database, store storage.ObjectStore, imageURLs *storage.ImageURLService) *Service {
+	return &Service{
+		repo:      newReviewRepository(db),
+		store:     store,
+		imageURLs: imageURLs,
+	}
+}
+
+// UploadReviewPhoto stores a photo for a review the user is about to write, only that user
+// can attach it. Photos never attached are removed by the orphan image cleanup, until then
+// they count against maxUnattachedPhotos.
+func (s *Service) UploadReviewPhoto(ctx context.Context, userId string, data []byte) (models.Images, []models.ImageRendition, error) {
+	// checked before processing the upload as well, so rejected uploads are never decoded
+	count, err := s.repo.countUnattachedPhotos(userId)
+	if err != nil {
+		return models.Images{}, nil, err
+	}
+	if count >= maxUnattachedPhotos {
+		return models.Images{}, nil, models.ErrTooManyPhotos
+	}
+
+	return storage.StoreImage(ctx, s.store, data, func(image *models.Images, renditions []models.ImageRendition) error {
+		image.UploadedBy = userId
+		return s.repo.createReviewPhoto(image, renditions, maxUnattachedPhotos)
+	})
+}
+
+// CreateReview accepts reviews of variants the user received only, new reviews wait for
+// moderation before they are shown. Photos must have been uploaded by the user through
+// UploadReviewPhoto and not be part of another review.
+func (s *Service) CreateReview(userId string, body *models.ReviewBody) (string, error) {
+	productId, err := s.repo.deliveredVariantProduct(userId, body.VariantId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", models.ErrNotVerifiedBuyer
+	}
+	if err != nil {
+		return "", err
+	}
+
+	exists, err := s.repo.reviewExists(userId, body.VariantId)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", models.ErrReviewExists
+	}
+
+	review := models.Review{
+		Id:        uuid.New().String(),
+		UserId:    userId,
+		ProductId: productId,
+		VariantId: body.VariantId,
+		Rating:    body.Rating,
+		Title:     body.Title,
+		Body:      body.Body,
+		Status:    models.ReviewPending,
+	}
+	if err := s.repo.createReview(&review, body.ImageIds); err != nil {
+		return "", err
+	}
+	return review.Id, nil
+}
+
+func (s *Service) GetProductReviews(productId string, params *pagination.Params) ([]models.ProductReview, error) {
+	reviews, err := s.repo.getReviews(productId, models.ReviewApproved, params)
+	if err != nil {
+		return nil, err
+	}
+	return reviews, s.addImageLinks(reviews)
+}
+
+func (s *Service) CountProductReviews(productId string) (int64, error) {
+	return s.repo.countReviews(productId, models.ReviewApproved)
+}
+
+func (s *Service) GetReviewsByStatus(status models.ReviewStatus, params *pagination.Params) ([]models.ProductReview, error) {
+	reviews, err := s.repo.getReviews("", status, params)
+	if err != nil {
+		return nil, err
+	}
+	return reviews, s.addImageLinks(reviews)
+}
+
+func (s *Service) CountReviewsByStatus(status models.ReviewStatus) (int64, error) {
+	return s.repo.countReviews("", status)
+}
+
+func (s *Service) ModerateReview(reviewId string, status models.ReviewStatus) error {
+	return s.repo.updateReviewStatus(reviewId, status)
+}
+
+func (s *Service) AddHelpfulVote(reviewId string, userId string) error {
+	return s.repo.addVote(reviewId, userId)
+}
+
+func (s *Service) RemoveHelpfulVote(reviewId string, userId string) error {
+	return s.repo.removeVote(reviewId, userId)
+}
+
+// ReviewSummaries returns the rating of every product with approved reviews keyed by
+// product id, products without any are left out.
+func (s *Service) ReviewSummaries(productIds []string) (map[string]models.ReviewSummary, error) {
+	summaries := make(map[string]models.ReviewSummary, len(productIds))
+	if len(productIds) == 0 {
+		return summaries, nil
+	}
+	rows, err := s.repo.getReviewSummaries(productIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		summaries[row.ProductId] = row
+	}
+	return summaries, nil
+}
+
+func (s *Service) addImageLinks(reviews []models.ProductReview) error {
+	reviewIds := make([]string, 0, len(reviews))
+	reviewIndex := make(map[string]int, len(reviews))
+	for i := range reviews {
+		reviews[i].ImageLinks = []string{}
+		reviewIds = append(reviewIds, reviews[i].Id)
+		reviewIndex[reviews[i].Id] = i
+	}
+	if len(reviewIds) == 0 {
+		return nil
+	}
+
+	images, err := s.repo.getReviewImages(reviewIds)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(images))
+	for _, image := range images {
+		paths = append(paths, image.Path)
+	}
+	urls := s.imageURLs.SignPaths(paths)
+	for _, image := range images {
+		review := &reviews[reviewIndex[image.ReviewId]]
+		review.ImageLinks = append(review.ImageLinks, urls[image.Path])
+	}
+	return nil
+}
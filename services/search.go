@@ -0,0 +1,13 @@
+package services
+
+import (
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+)
+
+type SearchServices interface {
+	SearchProducts(params *models.ProductSearchParams, page *pagination.Params) ([]models.AllProducts, error)
+	CountProducts(params *models.ProductSearchParams) (int64, error)
+	ProductFacets(params *models.ProductSearchParams) (models.ProductFacets, error)
+	Breadcrumbs(categoryIds []string) (map[string][]models.Breadcrumb, error)
+}
@@ -0,0 +1,268 @@
+package search
+
+import (
+	"fmt"
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+)
+
+const tsQuery = "websearch_to_tsquery('english', ?)"
+
+// priceBuckets are the ranges the price facet is counted in, a zero Max is unbounded.
+var priceBuckets = []models.PriceBucket{
+	{Min: 0, Max: 2000},
+	{Min: 2000, Max: 5000},
+	{Min: 5000, Max: 10000},
+	{Min: 10000, Max: 20000},
+	{Min: 20000},
+}
+
+type breadcrumbRow struct {
+	LeafId       string
+	Id           string
+	CategoryName string
+	Slug         string
+}
+
+type repository struct {
+	*internal.Database
+}
+
+func newSearchRepository(db *internal.Database) *repository {
+	return &repository{Database: db}
+}
+
+// filteredVariants starts a new query on every call, filters are always AND combined and
+// never leak into other queries through the shared connection.
+func (r *repository) filteredVariants(params *models.ProductSearchParams) *gorm.DB {
+	query := r.Database.DB.
+		Table("variants v").
+		Joins("join products p on p.id = v.product_id").
+		Joins("join brands b on b.id = p.brand_id").
+		Joins("join categories c on c.id = p.category_id").
+		Where("v.archived_at is null AND p.archived_at is null")
+	if params.Status != "" {
+		query = query.Where("p.status = ?", params.Status)
+	}
+	if params.SearchString != "" {
+		query = query.Where("p.search_vector @@ "+tsQuery, params.SearchString)
+	}
+	if params.Category != "" {
+		query = query.Where(categoryCondition(params.Category))
+	}
+	if params.Brand != "" {
+		query = query.Where("(b.brand_name = ? OR b.slug = ?)", params.Brand, params.Brand)
+	}
+	if params.MinPrice > 0 {
+		query = query.Where("effective_price(v) >= ?", params.MinPrice)
+	}
+	if params.MaxPrice > 0 {
+		query = query.Where("effective_price(v) <= ?", params.MaxPrice)
+	}
+	if params.Wireless != nil {
+		query = query.Where("p.wireless = ?", *params.Wireless)
+	}
+	if params.MinWarranty > 0 {
+		query = query.Where("p.warranty >= ?", params.MinWarranty)
+	}
+	if params.MinReturn > 0 {
+		query = query.Where("p.return >= ?", params.MinReturn)
+	}
+	if params.Colour != "" {
+		query = query.Where("lower(v.colour) = lower(?)", params.Colour)
+	}
+	if params.InStock {
+		query = query.Where("v.stock > 0")
+	}
+	for _, filter := range params.Attributes {
+		query = query.Where(attributeCondition(filter))
+	}
+	return query
+}
+
+// productSortColumns are the sort keys of the product listing, relevance is only offered
+// when searching.
+func productSortColumns(params *models.ProductSearchParams) pagination.Columns {
+	columns := pagination.Columns{
+		pagination.SortPrice:      {Expr: "listing.min_price", Type: pagination.Integer},
+		pagination.SortNewest:     {Expr: "listing.created_at", Type: pagination.Timestamp},
+		pagination.SortName:       {Expr: "listing.product_name", Type: pagination.Text},
+		pagination.SortPopularity: {Expr: "listing.popularity", Type: pagination.Integer},
+	}
+	if params.SearchString != "" {
+		columns[pagination.SortRelevance] = pagination.Column{Expr: "listing.relevance", Type: pagination.Real}
+	}
+	return columns
+}
+
+// productListing has one row per product with a variant matching the filters, carrying the
+// values the listing is sorted by.
+func (r *repository) productListing(params *models.ProductSearchParams) *gorm.DB {
+	columns := "p.id, p.product_name, p.created_at, min(effective_price(v)) as min_price, " +
+		"(select coalesce(sum(po.quantity), 0) from product_ordereds po join variants pv on pv.id = po.variant_id where pv.product_id = p.id) as popularity"
+	var vars []interface{}
+	if params.SearchString != "" {
+		columns += ", ts_rank(p.search_vector, " + tsQuery + ") as relevance"
+		vars = append(vars, params.SearchString)
+	}
+
+	listing := r.filteredVariants(params).
+		Select(columns, vars...).
+		Group("p.id")
+	return r.Database.DB.Table("(?) as listing", listing)
+}
+
+// categoryCondition matches products of the category named or slugged category and of all
+// its subcategories.
+func categoryCondition(category string) clause.Expr {
+	return clause.Expr{
+		SQL: "p.category_id IN (WITH RECURSIVE tree AS (" +
+			"SELECT id FROM categories WHERE (category_name = ? OR slug = ?) AND archived_at IS NULL " +
+			"UNION SELECT sub.id FROM categories sub JOIN tree ON sub.parent_id = tree.id WHERE sub.archived_at IS NULL" +
+			") SELECT id FROM tree)",
+		Vars: []interface{}{category, category},
+	}
+}
+
+// attributeCondition matches products with a value of the attribute satisfying the filter,
+// numbers given for equality are compared numerically so 40 matches 40.0.
+func attributeCondition(filter models.AttributeFilter) clause.Expr {
+	condition := "exists (select 1 from product_attribute_values pav join attributes a on a.id = pav.attribute_id " +
+		"where pav.product_id = p.id and a.archived_at is null and a.key = ?"
+	vars := []interface{}{filter.Key}
+	if filter.Value != "" {
+		if number, err := strconv.ParseFloat(filter.Value, 64); err == nil {
+			condition += " and (pav.number_value = ? or lower(pav.text_value) = lower(?))"
+			vars = append(vars, number, filter.Value)
+		} else {
+			condition += " and lower(pav.text_value) = lower(?)"
+			vars = append(vars, filter.Value)
+		}
+	}
+	if filter.Min != nil {
+		condition += " and pav.number_value >= ?"
+		vars = append(vars, *filter.Min)
+	}
+	if filter.Max != nil {
+		condition += " and pav.number_value <= ?"
+		vars = append(vars, *filter.Max)
+	}
+	return clause.Expr{SQL: condition + ")", Vars: vars}
+}
+
+// searchProducts returns one row per image of every matching variant of the products on
+// the page, ordered by product so they can be grouped without sorting again.
+func (r *repository) searchProducts(params *models.ProductSearchParams, page *pagination.Params) ([]models.AllProducts, error) {
+	productIds, err := page.Keys(r.productListing(params), "listing.id", productSortColumns(params))
+	if err != nil || len(productIds) == 0 {
+		return nil, err
+	}
+
+	var products []models.AllProducts
+	err = r.filteredVariants(params).
+		Select("p.id as product_id, v.id as variant_id, p.product_name, p.model_name, b.brand_name, b.slug as brand_slug, p.category_id, c.category_name, p.return, p.warranty, p.wireless, p.status, v.colour, effective_price(v) as price, v.price as compare_at_price, v.stock, i.id as image_id, i.bucket_name, i.path, coalesce(i.width, 0) as width, coalesce(i.height, 0) as height, coalesce(vi.alt_text, '') as alt_text").
+		Joins("left join variant_images vi on vi.variant_id = v.id and vi.archived_at is null").
+		Joins("left join images i on i.id = vi.image_id and i.archived_at is null").
+		Where("p.id IN ?", productIds).
+		Order("effective_price(v), v.colour, v.id, vi.is_primary desc, vi.position, vi.created_at").
+		Scan(&products).
+		Error
+	pagination.Reorder(productIds, products, func(product models.AllProducts) string { return product.ProductID })
+	return products, err
+}
+
+func (r *repository) countProducts(params *models.ProductSearchParams) (int64, error) {
+	var count int64
+	err := r.filteredVariants(params).
+		Distinct("p.id").
+		Count(&count).
+		Error
+	return count, err
+}
+
+func (r *repository) facetCounts(params *models.ProductSearchParams, column string) ([]models.FacetCount, error) {
+	var counts []models.FacetCount
+	err := r.filteredVariants(params).
+		Select(column + "::text as value, count(distinct p.id) as count").
+		Group(column).
+		Order("count desc, value").
+		Scan(&counts).
+		Error
+	return counts, err
+}
+
+func (r *repository) priceFacet(params *models.ProductSearchParams) ([]models.PriceBucket, error) {
+	columns := make([]string, 0, len(priceBuckets))
+	var vars []interface{}
+	for i, bucket := range priceBuckets {
+		if bucket.Max == 0 {
+			columns = append(columns, fmt.Sprintf("count(distinct p.id) filter (where effective_price(v) >= ?) as bucket%d", i))
+			vars = append(vars, bucket.Min)
+		} else {
+			columns = append(columns, fmt.Sprintf("count(distinct p.id) filter (where effective_price(v) >= ? and effective_price(v) < ?) as bucket%d", i))
+			vars = append(vars, bucket.Min, bucket.Max)
+		}
+	}
+
+	counts := make([]int64, len(priceBuckets))
+	targets := make([]interface{}, len(priceBuckets))
+	for i := range counts {
+		targets[i] = &counts[i]
+	}
+	err := r.filteredVariants(params).
+		Select(strings.Join(columns, ", "), vars...).
+		Row().
+		Scan(targets...)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]models.PriceBucket, len(priceBuckets))
+	for i, bucket := range priceBuckets {
+		buckets[i] = bucket
+		buckets[i].Count = counts[i]
+	}
+	return buckets, nil
+}
+
+func (r *repository) productFacets(params *models.ProductSearchParams) (models.ProductFacets, error) {
+	facets := models.ProductFacets{}
+	var err error
+	if facets.Brands, err = r.facetCounts(params, "b.brand_name"); err != nil {
+		return facets, err
+	}
+	if facets.Categories, err = r.facetCounts(params, "c.category_name"); err != nil {
+		return facets, err
+	}
+	if facets.Wireless, err = r.facetCounts(params, "p.wireless"); err != nil {
+		return facets, err
+	}
+	if facets.Colours, err = r.facetCounts(params, "v.colour"); err != nil {
+		return facets, err
+	}
+	facets.PriceBuckets, err = r.priceFacet(params)
+	return facets, err
+}
+
+// breadcrumbs walks from every category up to the top level, the depth guard stops
+// corrupted parent links from looping forever.
+func (r *repository) breadcrumbs(categoryIds []string) ([]breadcrumbRow, error) {
+	var rows []breadcrumbRow
+	err := r.Database.DB.Raw(`WITH RECURSIVE path AS (
+			SELECT c.id AS leaf_id, c.id, c.category_name, c.slug, c.parent_id, 0 AS depth
+			FROM categories c WHERE c.id IN ?
+			UNION ALL
+			SELECT path.leaf_id, parent.id, parent.category_name, parent.slug, parent.parent_id, path.depth + 1
+			FROM categories parent JOIN path ON parent.id = path.parent_id
+			WHERE path.depth < 32
+		)
+		SELECT leaf_id, id, category_name, slug FROM path ORDER BY leaf_id, depth DESC`, categoryIds).
+		Scan(&rows).
+		Error
+	return rows, err
+}
@@ -0,0 +1,47 @@
+package search
+
+import (
+	"github.com/Shresth92/audiophile/internal"
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+)
+
+type Service struct {
+	repo *repository
+}
+
+func NewSearchService(db *internal.Database) *Service {
+	return &Service{repo: newSearchRepository(db)}
+}
+
+func (s *Service) SearchProducts(params *models.ProductSearchParams, page *pagination.Params) ([]models.AllProducts, error) {
+	return s.repo.searchProducts(params, page)
+}
+
+func (s *Service) CountProducts(params *models.ProductSearchParams) (int64, error) {
+	return s.repo.countProducts(params)
+}
+
+func (s *Service) ProductFacets(params *models.ProductSearchParams) (models.ProductFacets, error) {
+	return s.repo.productFacets(params)
+}
+
+// Breadcrumbs returns the path from the top level down to each of the categories.
+func (s *Service) Breadcrumbs(categoryIds []string) (map[string][]models.Breadcrumb, error) {
+	breadcrumbs := make(map[string][]models.Breadcrumb, len(categoryIds))
+	if len(categoryIds) == 0 {
+		return breadcrumbs, nil
+	}
+	rows, err := s.repo.breadcrumbs(categoryIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		breadcrumbs[row.LeafId] = append(breadcrumbs[row.LeafId], models.Breadcrumb{
+			Id:   row.Id,
+			Name: row.CategoryName,
+			Slug: row.Slug,
+		})
+	}
+	return breadcrumbs, nil
+}
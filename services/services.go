@@ -3,6 +3,9 @@ package services
 import (
 	"github.com/Shresth92/audiophile/services/admin"
 	"github.com/Shresth92/audiophile/services/public"
+	"github.com/Shresth92/audiophile/services/question"
+	"github.com/Shresth92/audiophile/services/review"
+	"github.com/Shresth92/audiophile/services/search"
 	"github.com/Shresth92/audiophile/services/user"
 	"go.uber.org/fx"
 )
@@ -32,4 +35,28 @@ var Module = fx.Options(
 			),
 		),
 	),
+	fx.Provide(
+		fx.Annotate(
+			search.NewSearchService,
+			fx.As(
+				new(SearchServices),
+			),
+		),
+	),
+	fx.Provide(
+		fx.Annotate(
+			review.NewReviewService,
+			fx.As(
+				new(ReviewServices),
+			),
+		),
+	),
+	fx.Provide(
+		fx.Annotate(
+			question.NewQuestionService,
+			fx.As(
+				new(QuestionServices),
+			),
+		),
+	),
 )
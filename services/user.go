@@ -1,6 +1,9 @@
 package services
 
-import "github.com/Shresth92/audiophile/models"
+import (
+	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+)
 
 type UserServices interface {
 	AddProductToCart(userID string, variantID string) error
@@ -8,16 +11,27 @@ type UserServices interface {
 	RemoveProductFromCart(userID string, variantID string) error
 	DeleteCart(userID string) error
 	GetCartProducts(userID string) ([]models.UserCart, error)
-	GetProduct(productId string) ([]models.AllProducts, error)
+	GetProduct(productId string, includeDrafts bool) ([]models.AllProducts, error)
+	GetProductAttributes(productId string) ([]models.ProductAttribute, error)
+	GetImageRenditions(imageIds []string) (map[string][]models.ImageRendition, error)
+	CompareProducts(ids []string) (models.ProductComparison, error)
 	GetTotalProductCost(variantIds []string) (int, error)
 	PriceAfterDiscount(price int, couponCode string) (int, error)
-	FilterMyOrders(userId string, ProductStatus models.DeliveryStatus, limit int, page int) ([]models.Orders, error)
+	FilterMyOrders(userId string, ProductStatus models.DeliveryStatus, params *pagination.Params) ([]models.Orders, error)
 	CountFilterMyOrders(userId string, ProductStatus models.DeliveryStatus) (int64, error)
 	UpdateProductStock(variantId string, stock int) error
-	FilterAllProducts(limit int, page int, searchString string, categoryFilter string, brandFilter string) ([]models.AllProducts, error)
-	FilterAllProductsCount(searchString string, categoryFilter string, brandFilter string) (int64, error)
 	GenerateOrderIdByCart(price int, userId string, addressId string) (string, error)
 	AddProductsInOrder(orderedProducts []models.ProductOrdered) error
 	GetAllOffers() ([]models.Offer, error)
+	GetActiveOffers() ([]models.PublicOffer, error)
 	AddAddress(userID string, newAddress *models.Address) (string, error)
+	GetUserById(userID string) (models.Users, error)
+	ChangePassword(userID string, sessionID string, hashedPassword string) error
+	UpdateProfile(userID string, profile *models.ProfileBody) error
+	EmailInUse(email string) (bool, error)
+	CreateEmailChangeToken(userID string, newEmail string) (string, error)
+	DeleteAccount(userID string) error
+	CreateDataExport(userID string) (models.DataExport, error)
+	GetDataExport(userID string, exportID string, withArchive bool) (models.DataExport, error)
+	RecoverDataExports() (int64, error)
 }
@@ -4,11 +4,17 @@ import (
 	"errors"
 	"github.com/Shresth92/audiophile/internal"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"time"
 )
 
+var orderSortColumns = pagination.Columns{
+	pagination.SortNewest: {Expr: "ordered_at", Type: pagination.Timestamp},
+	pagination.SortPrice:  {Expr: "cost", Type: pagination.Integer},
+}
+
 type repository struct {
 	*internal.Database
 }
@@ -17,6 +23,19 @@ func newUserRepository(db *internal.Database) *repository {
 	return &repository{Database: db}
 }
 
+// countAvailableVariants counts the given variants that are for sale, those of published
+// products that are not archived.
+func (r *repository) countAvailableVariants(variantIds []string) (int64, error) {
+	var count int64
+	err := r.Database.DB.
+		Table("variants v").
+		Joins("join products p on p.id = v.product_id").
+		Where("v.id IN ? and p.status = ? and p.archived_at is null and v.archived_at is null", variantIds, models.ProductPublished).
+		Count(&count).
+		Error
+	return count, err
+}
+
 func (r *repository) addProductToCart(userId string, variantId string, count int) error {
 	cartId := uuid.New().String()
 	cart := models.UserCart{
@@ -75,22 +94,99 @@ func (r *repository) deleteCart(userId string) error {
 	return err
 }
 
-func (r *repository) getProduct(productId string) ([]models.AllProducts, error) {
+// getProduct returns one row per image of every variant of the product, drafts are only
+// returned when includeDrafts is set.
+func (r *repository) getProduct(productId string, includeDrafts bool) ([]models.AllProducts, error) {
+	query := r.Database.DB.
+		Table("variants v").
+		Select("p.id as product_id, v.id as variant_id, p.product_name, p.model_name, b.brand_name, b.slug as brand_slug, p.category_id, c.category_name, p.return, p.warranty, p.wireless, p.status, v.colour, effective_price(v) as price, v.price as compare_at_price, v.stock, i.id as image_id, i.bucket_name, i.path, coalesce(i.width, 0) as width, coalesce(i.height, 0) as height, coalesce(vi.alt_text, '') as alt_text").
+		Joins("join products p on p.id = v.product_id").
+		Joins("join brands b on b.id = p.brand_id").
+		Joins("join categories c on c.id = p.category_id").
+		Joins("left join variant_images vi on vi.variant_id = v.id and vi.archived_at is null").
+		Joins("left join images i on i.id = vi.image_id and i.archived_at is null").
+		Where("p.id = ? and p.archived_at is null and v.archived_at is null", productId)
+	if !includeDrafts {
+		query = query.Where("p.status = ?", models.ProductPublished)
+	}
+
 	var product []models.AllProducts
-	err := r.Database.DB.Table("products").
-		Joins("join brands b on products.brand_id=b.id").
-		Joins("join categories c on products.category_id=c.id").
-		Joins("join variants v on v.product_id=products.id").
-		Joins("left join variant_images vi on v.id=vi.variant_id").
-		Joins("join images i on i.id=vi.image_id").
-		Where("products.id = ?", productId).Find(&product).Error
+	err := query.
+		Order("effective_price(v), v.colour, v.id, vi.is_primary desc, vi.position, vi.created_at").
+		Scan(&product).
+		Error
 	return product, err
 }
 
+// getComparedVariants returns the variants of the given products along with the given variants.
+func (r *repository) getComparedVariants(ids []string) ([]models.AllProducts, error) {
+	var variants []models.AllProducts
+	err := r.Database.DB.
+		Table("variants v").
+		Select("p.id as product_id, v.id as variant_id, p.product_name, p.model_name, b.brand_name, b.slug as brand_slug, p.category_id, c.category_name, p.return, p.warranty, p.wireless, p.status, v.colour, effective_price(v) as price, v.price as compare_at_price, v.stock").
+		Joins("join products p on p.id = v.product_id").
+		Joins("join brands b on b.id = p.brand_id").
+		Joins("join categories c on c.id = p.category_id").
+		Where("(p.id IN ? or v.id IN ?) and p.status = ? and p.archived_at is null and v.archived_at is null", ids, ids, models.ProductPublished).
+		Order("effective_price(v), v.colour, v.id").
+		Scan(&variants).
+		Error
+	return variants, err
+}
+
+type productAttributeRow struct {
+	Key         string
+	Name        string
+	Type        models.AttributeType
+	Unit        string
+	TextValue   string
+	NumberValue *float64
+}
+
+func (r *repository) getImageRenditions(imageIds []string) ([]models.ImageRendition, error) {
+	var renditions []models.ImageRendition
+	err := r.Database.DB.
+		Model(&models.ImageRendition{}).
+		Where("image_id IN ?", imageIds).
+		Find(&renditions).
+		Error
+	return renditions, err
+}
+
+func (r *repository) getProductAttributes(productId string) ([]productAttributeRow, error) {
+	var rows []productAttributeRow
+	err := r.Database.DB.
+		Table("product_attribute_values pav").
+		Select("a.key, a.name, a.type, a.unit, pav.text_value, pav.number_value").
+		Joins("join attributes a on a.id = pav.attribute_id").
+		Where("pav.product_id = ? and a.archived_at is null", productId).
+		Order("a.name, pav.text_value").
+		Scan(&rows).
+		Error
+	return rows, err
+}
+
+// getTotalProductCost sums the prices of the given variants, it fails with
+// ErrVariantNotFound when one of them is not for sale.
 func (r *repository) getTotalProductCost(variantIds []string) (int, error) {
 	var costs []int
 	totalCost := 0
-	err := r.Database.DB.Model(&models.Variants{}).Where("id IN ?", variantIds).Pluck("price", &costs).Error
+	err := r.Database.DB.
+		Table("variants v").
+		Joins("join products p on p.id = v.product_id").
+		Where("v.id IN ? and p.status = ? and p.archived_at is null and v.archived_at is null", variantIds, models.ProductPublished).
+		Pluck("effective_price(v)", &costs).
+		Error
+	if err != nil {
+		return 0, err
+	}
+	unique := make(map[string]bool, len(variantIds))
+	for _, variantId := range variantIds {
+		unique[variantId] = true
+	}
+	if len(costs) != len(unique) {
+		return 0, models.ErrVariantNotFound
+	}
 	for _, cost := range costs {
 		totalCost += cost
 	}
@@ -115,20 +211,28 @@ func (r *repository) priceAfterDiscount(price int, couponCode string) (int, erro
 	return discountedPrice, err
 }
 
-func (r *repository) filterMyOrders(userId string, ProductStatus models.DeliveryStatus, limit int, page int) ([]models.Orders, error) {
+func (r *repository) filterMyOrders(userId string, ProductStatus models.DeliveryStatus, params *pagination.Params) ([]models.Orders, error) {
+	orderIds, err := params.Keys(r.Database.DB.Model(&models.Orders{}).Where("user_id = ? and delivery_status = ?", userId, ProductStatus), "id", orderSortColumns)
+	if err != nil || len(orderIds) == 0 {
+		return nil, err
+	}
+
 	var orders []models.Orders
-	err := r.Database.DB.
+	err = r.Database.DB.
 		Preload("ProductOrdered").
-		Where("user_id = ? and delivery_status = ?", userId, ProductStatus).
-		Limit(limit).
-		Offset(limit * (page - 1)).
+		Where("id IN ?", orderIds).
 		Find(&orders).Error
+	pagination.Reorder(orderIds, orders, func(order models.Orders) string { return order.ID })
 	return orders, err
 }
 
 func (r *repository) countFilterMyOrders(userId string, ProductStatus models.DeliveryStatus) (int64, error) {
 	var count int64
-	err := r.Database.DB.Where("user_id = ? and delivery_status = ?", userId, ProductStatus).Count(&count).Error
+	err := r.Database.DB.
+		Model(&models.Orders{}).
+		Where("user_id = ? and delivery_status = ?", userId, ProductStatus).
+		Count(&count).
+		Error
 	return count, err
 }
 
@@ -141,51 +245,6 @@ func (r *repository) updateProductStock(variantId string, stock int) error {
 	return err
 }
 
-func (r *repository) filterAllProducts(limit int, page int, searchString string, categoryFilter string, brandFilter string) ([]models.AllProducts, error) {
-	var product []models.AllProducts
-	if searchString != "" {
-		r.Database.DB = r.Database.DB.Where("products.product_name ilike ?", searchString)
-	}
-	if categoryFilter != "" {
-		r.Database.DB = r.Database.DB.Or("c.category_name = ?", categoryFilter)
-	}
-	if brandFilter != "" {
-		r.Database.DB = r.Database.DB.Or("b.brand_name = ?", brandFilter)
-	}
-	dbQuery := r.Database.DB.Table("products").
-		Joins("join brands b on products.brand_id=b.id").
-		Joins("join categories c on products.category_id=c.id").
-		Joins("join variants v on v.product_id=products.id").
-		Joins("left join variant_images vi on v.id=vi.variant_id").
-		Joins("join images i on i.id=vi.image_id").
-		Limit(limit).
-		Offset(limit * (page - 1)).
-		Scan(&product)
-	return product, dbQuery.Error
-}
-
-func (r *repository) filterAllProductsCount(searchString string, categoryFilter string, brandFilter string) (int64, error) {
-	var count int64
-	if searchString != "" {
-		r.Database.DB = r.Database.DB.Where("products.product_name ilike ?", searchString)
-	}
-	if categoryFilter != "" {
-		r.Database.DB = r.Database.DB.Or("c.category_name = ?", categoryFilter)
-	}
-	if brandFilter != "" {
-		r.Database.DB = r.Database.DB.Or("b.brand_name = ?", brandFilter)
-	}
-	err := r.Database.DB.Table("products").
-		Joins("join brands b on products.brand_id=b.id").
-		Joins("join categories c on products.category_id=c.id").
-		Joins("join variants v on v.product_id=products.id").
-		Joins("left join variant_images vi on v.id=vi.variant_id").
-		Joins("join images i on i.id=vi.image_id").
-		Count(&count).
-		Error
-	return count, err
-}
-
 func (r *repository) generateOrderIdByCart(price int, userId string, addressId string) (string, error) {
 	orderId := uuid.New().String()
 	order := models.Orders{
@@ -220,6 +279,18 @@ func (r *repository) getAllOffers() ([]models.Offer, error) {
 	return offers, err
 }
 
+func (r *repository) getActiveOffers() ([]models.PublicOffer, error) {
+	var offers []models.PublicOffer
+	err := r.Database.DB.
+		Model(&models.Offer{}).
+		Select("id, offer_name, percent, max_discount, validity, description").
+		Where("archived_at is null and validity > ?", time.Now()).
+		Order("validity").
+		Scan(&offers).
+		Error
+	return offers, err
+}
+
 func (r *repository) addAddress(userId string, newAddress *models.Address) (string, error) {
 	addressId := uuid.New().String()
 	address := models.Address{
@@ -238,3 +309,303 @@ func (r *repository) addAddress(userId string, newAddress *models.Address) (stri
 		Error
 	return addressId, err
 }
+
+func (r *repository) getUserById(userId string) (models.Users, error) {
+	user := models.Users{}
+	err := r.Database.DB.
+		Model(&models.Users{}).
+		Where("id = ? AND archived_at is null", userId).
+		First(&user).
+		Error
+	return user, err
+}
+
+func (r *repository) changePassword(userId string, sessionId string, hashedPassword string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Model(&models.Users{}).
+			Where("id = ? AND archived_at is null", userId).
+			Updates(map[string]interface{}{"password": hashedPassword, "updated_at": time.Now()}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		return tx.
+			Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND ended_at > ?", userId, sessionId, time.Now()).
+			Update("ended_at", time.Now()).
+			Error
+	})
+}
+
+func (r *repository) updateProfile(userId string, profile *models.ProfileBody) error {
+	err := r.Database.DB.
+		Model(&models.Users{}).
+		Where("id = ? AND archived_at is null", userId).
+		Updates(map[string]interface{}{
+			"name":       profile.Name,
+			"phone":      profile.Phone,
+			"updated_at": time.Now(),
+		}).
+		Error
+	return err
+}
+
+func (r *repository) emailInUse(email string) (bool, error) {
+	var count int64
+	err := r.Database.DB.
+		Model(&models.Users{}).
+		Where("email = ? AND archived_at is null", email).
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+func (r *repository) createUserToken(userId string, purpose models.TokenPurpose, tokenHash string, payload string, expiresAt time.Time) error {
+	tokenId := uuid.New().String()
+	token := models.UserToken{
+		Id:        tokenId,
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		Payload:   payload,
+		ExpiresAt: expiresAt,
+	}
+	err := r.Database.DB.
+		Model(&models.UserToken{}).
+		Create(&token).
+		Error
+	return err
+}
+
+// deleteAccount archives the user and strips everything that identifies them. Orders
+// are kept for accounting, they only point at the anonymized user and address rows.
+func (r *repository) deleteAccount(userId string) error {
+	return r.Database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.
+			Model(&models.Users{}).
+			Where("id = ? AND archived_at is null", userId).
+			Updates(map[string]interface{}{
+				"email":       "deleted-" + userId + "@deleted.invalid",
+				"password":    "",
+				"name":        "",
+				"phone":       "",
+				"updated_at":  now,
+				"archived_at": now,
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(&models.Address{}).
+			Where("user_id = ?", userId).
+			Updates(map[string]interface{}{
+				"area":        "",
+				"city":        "",
+				"state":       "",
+				"zipcode":     "",
+				"contact":     "",
+				"lat_long":    gorm.Expr("NULL"),
+				"updated_at":  now,
+				"archived_at": gorm.Expr("coalesce(archived_at, ?)", now),
+			}).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(&models.Session{}).
+			Where("user_id = ? AND ended_at > ?", userId, now).
+			Update("ended_at", now).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(&models.UserCart{}).
+			Where("user_id = ? AND archived_at is null", userId).
+			Update("archived_at", now).
+			Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.
+			Model(&models.UserRole{}).
+			Where("user_id = ? AND archived_at is null", userId).
+			Update("archived_at", now).
+			Error
+		if err != nil {
+			return err
+		}
+
+		for _, credentials := range []interface{}{&models.UserIdentity{}, &models.UserToken{}, &models.UserTotp{}, &models.RecoveryCode{}} {
+			if err := tx.Where("user_id = ?", userId).Delete(credentials).Error; err != nil {
+				return err
+			}
+		}
+
+		// data exports hold an archive of everything removed above
+		return tx.
+			Where("user_id = ?", userId).
+			Delete(&models.DataExport{}).
+			Error
+	})
+}
+
+// getActiveDataExport returns the pending or running export of the user created after cutoff.
+func (r *repository) getActiveDataExport(userId string, cutoff time.Time) (models.DataExport, error) {
+	export := models.DataExport{}
+	err := r.Database.DB.
+		Model(&models.DataExport{}).
+		Omit("archive").
+		Where("user_id = ? AND status IN ? AND created_at > ?", userId, []models.ExportStatus{models.ExportPending, models.ExportRunning}, cutoff).
+		First(&export).
+		Error
+	return export, err
+}
+
+// failActiveDataExports marks the pending and running exports created before cutoff as
+// failed, those of every user when userId is empty.
+func (r *repository) failActiveDataExports(userId string, cutoff time.Time, reason string) (int64, error) {
+	query := r.Database.DB.
+		Model(&models.DataExport{}).
+		Where("status IN ? AND created_at < ?", []models.ExportStatus{models.ExportPending, models.ExportRunning}, cutoff)
+	if userId != "" {
+		query = query.Where("user_id = ?", userId)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":       models.ExportFailed,
+		"error":        reason,
+		"completed_at": time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
+
+func (r *repository) createDataExport(export *models.DataExport) error {
+	err := r.Database.DB.
+		Where("expires_at < ?", time.Now()).
+		Delete(&models.DataExport{}).
+		Error
+	if err != nil {
+		return err
+	}
+
+	err = r.Database.DB.
+		Model(&models.DataExport{}).
+		Create(export).
+		Error
+	return err
+}
+
+func (r *repository) getDataExport(userId string, exportId string, withArchive bool) (models.DataExport, error) {
+	export := models.DataExport{}
+	query := r.Database.DB.
+		Model(&models.DataExport{}).
+		Where("id = ? AND user_id = ?", exportId, userId)
+	if !withArchive {
+		query = query.Omit("archive")
+	}
+	err := query.First(&export).Error
+	return export, err
+}
+
+// updateDataExport updates the export while it still has the given status and reports
+// whether it did, an export that timed out meanwhile is left alone.
+func (r *repository) updateDataExport(exportId string, status models.ExportStatus, updates map[string]interface{}) (bool, error) {
+	result := r.Database.DB.
+		Model(&models.DataExport{}).
+		Where("id = ? AND status = ?", exportId, status).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *repository) collectUserData(userId string) (models.UserDataExport, error) {
+	data := models.UserDataExport{}
+	user := models.Users{}
+	err := r.Database.DB.
+		Model(&models.Users{}).
+		Where("id = ?", userId).
+		First(&user).
+		Error
+	if err != nil {
+		return data, err
+	}
+	data.Profile = models.Profile{
+		Id:        user.Id,
+		Email:     user.Email,
+		Name:      user.Name,
+		Phone:     user.Phone,
+		CreatedAt: user.CreatedAt,
+	}
+
+	err = r.Database.DB.
+		Model(&models.Address{}).
+		Where("user_id = ?", userId).
+		Find(&data.Addresses).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.Session{}).
+		Where("user_id = ?", userId).
+		Find(&data.Sessions).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.UserCart{}).
+		Preload("Variant.Product").
+		Where("user_id = ?", userId).
+		Find(&data.Cart).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.Orders{}).
+		Preload("Address").
+		Preload("ProductOrdered.Variant.Product").
+		Where("user_id = ?", userId).
+		Find(&data.Orders).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.Review{}).
+		Where("user_id = ?", userId).
+		Find(&data.Reviews).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.Question{}).
+		Where("user_id = ?", userId).
+		Find(&data.Questions).
+		Error
+	if err != nil {
+		return data, err
+	}
+
+	err = r.Database.DB.
+		Model(&models.Answer{}).
+		Where("user_id = ?", userId).
+		Find(&data.Answers).
+		Error
+	return data, err
+}
@@ -1,8 +1,28 @@
 package user
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Shresth92/audiophile/internal"
 	"github.com/Shresth92/audiophile/models"
+	"github.com/Shresth92/audiophile/pagination"
+	"github.com/Shresth92/audiophile/utils"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"sort"
+	"time"
+)
+
+const (
+	emailChangeValidity = 24 * time.Hour
+	dataExportRetention = 7 * 24 * time.Hour
+	// dataExportTimeout is how long an export may stay pending or running before it is
+	// considered lost and the user can request a new one
+	dataExportTimeout = 30 * time.Minute
 )
 
 type Service struct {
@@ -13,7 +33,15 @@ func NewUserService(db *internal.Database) *Service {
 	return &Service{repo: newUserRepository(db)}
 }
 
+// AddProductToCart fails with models.ErrVariantNotFound when the variant is not for sale.
 func (s *Service) AddProductToCart(userID string, variantID string) error {
+	available, err := s.repo.countAvailableVariants([]string{variantID})
+	if err != nil {
+		return err
+	}
+	if available == 0 {
+		return models.ErrVariantNotFound
+	}
 	return s.repo.addProductToCart(userID, variantID, 1)
 }
 
@@ -33,8 +61,175 @@ func (s *Service) GetCartProducts(userID string) ([]models.UserCart, error) {
 	return s.repo.getCartProducts(userID)
 }
 
-func (s *Service) GetProduct(productId string) ([]models.AllProducts, error) {
-	return s.repo.getProduct(productId)
+func (s *Service) GetProduct(productId string, includeDrafts bool) ([]models.AllProducts, error) {
+	return s.repo.getProduct(productId, includeDrafts)
+}
+
+// GetImageRenditions returns the renditions of every image keyed by image id, images
+// uploaded before renditions were generated have none.
+func (s *Service) GetImageRenditions(imageIds []string) (map[string][]models.ImageRendition, error) {
+	renditions := make(map[string][]models.ImageRendition, len(imageIds))
+	if len(imageIds) == 0 {
+		return renditions, nil
+	}
+	rows, err := s.repo.getImageRenditions(imageIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, rendition := range rows {
+		renditions[rendition.ImageId] = append(renditions[rendition.ImageId], rendition)
+	}
+	return renditions, nil
+}
+
+// GetProductAttributes returns the specification of the product, values of list
+// attributes are collected into one entry.
+func (s *Service) GetProductAttributes(productId string) ([]models.ProductAttribute, error) {
+	rows, err := s.repo.getProductAttributes(productId)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make([]models.ProductAttribute, 0)
+	attributeIndex := make(map[string]int)
+	for _, row := range rows {
+		index, ok := attributeIndex[row.Key]
+		if !ok {
+			index = len(attributes)
+			attributeIndex[row.Key] = index
+			attributes = append(attributes, models.ProductAttribute{
+				Key:  row.Key,
+				Name: row.Name,
+				Type: row.Type,
+				Unit: row.Unit,
+			})
+		}
+
+		switch row.Type {
+		case models.AttributeNumber:
+			attributes[index].Value = row.NumberValue
+		case models.AttributeBoolean:
+			attributes[index].Value = row.TextValue == "true"
+		case models.AttributeList:
+			items, _ := attributes[index].Value.([]string)
+			attributes[index].Value = append(items, row.TextValue)
+		default:
+			attributes[index].Value = row.TextValue
+		}
+	}
+	return attributes, nil
+}
+
+// CompareProducts lines up the specification of products, or single variants of them, in
+// the order of ids. Prices and stock of a product cover all of its variants.
+func (s *Service) CompareProducts(ids []string) (models.ProductComparison, error) {
+	comparison := models.ProductComparison{
+		Products: make([]models.ComparedProduct, 0, len(ids)),
+		Rows:     make([]models.ComparisonRow, 0),
+	}
+	variants, err := s.repo.getComparedVariants(ids)
+	if err != nil {
+		return comparison, err
+	}
+
+	prices := make([]interface{}, 0, len(ids))
+	stocks := make([]interface{}, 0, len(ids))
+	warranties := make([]interface{}, 0, len(ids))
+	returns := make([]interface{}, 0, len(ids))
+	wireless := make([]interface{}, 0, len(ids))
+	attributeRows := make([]models.ComparisonRow, 0)
+	attributeIndex := make(map[string]int)
+	for position, id := range ids {
+		var matched []models.AllProducts
+		for _, variant := range variants {
+			if variant.ProductID == id || variant.VariantID == id {
+				matched = append(matched, variant)
+			}
+		}
+		if len(matched) == 0 {
+			return comparison, fmt.Errorf("%w: %s", models.ErrProductNotFound, id)
+		}
+
+		first := matched[0]
+		compared := models.ComparedProduct{
+			ProductId:    first.ProductID,
+			ProductName:  first.ProductName,
+			ModelName:    first.ModelName,
+			BrandName:    first.BrandName,
+			CategoryName: first.CategoryName,
+		}
+		if first.VariantID == id {
+			compared.VariantId = first.VariantID
+			compared.Colour = first.Colour
+		}
+		comparison.Products = append(comparison.Products, compared)
+
+		price := models.PriceRange{Min: first.Price, Max: first.Price}
+		stock := 0
+		for _, variant := range matched {
+			if variant.Price < price.Min {
+				price.Min = variant.Price
+			}
+			if variant.Price > price.Max {
+				price.Max = variant.Price
+			}
+			stock += variant.Stock
+		}
+		prices = append(prices, price)
+		stocks = append(stocks, stock)
+		warranties = append(warranties, first.Warranty)
+		returns = append(returns, first.Return)
+		wireless = append(wireless, first.Wireless)
+
+		attributes, err := s.GetProductAttributes(first.ProductID)
+		if err != nil {
+			return comparison, err
+		}
+		for _, attribute := range attributes {
+			index, ok := attributeIndex[attribute.Key]
+			if !ok {
+				index = len(attributeRows)
+				attributeIndex[attribute.Key] = index
+				attributeRows = append(attributeRows, models.ComparisonRow{
+					Key:    attribute.Key,
+					Name:   attribute.Name,
+					Unit:   attribute.Unit,
+					Values: make([]interface{}, len(ids)),
+				})
+			}
+			attributeRows[index].Values[position] = attribute.Value
+		}
+	}
+
+	sort.SliceStable(attributeRows, func(i, j int) bool {
+		return attributeRows[i].Name < attributeRows[j].Name
+	})
+	comparison.Rows = append(comparison.Rows,
+		models.ComparisonRow{Key: "price", Name: "Price", Values: prices},
+		models.ComparisonRow{Key: "stock", Name: "Stock", Values: stocks},
+		models.ComparisonRow{Key: "warranty", Name: "Warranty", Values: warranties},
+		models.ComparisonRow{Key: "return", Name: "Return window", Values: returns},
+		models.ComparisonRow{Key: "wireless", Name: "Wireless", Values: wireless},
+	)
+	comparison.Rows = append(comparison.Rows, attributeRows...)
+	for i := range comparison.Rows {
+		comparison.Rows[i].Differs = valuesDiffer(comparison.Rows[i].Values)
+	}
+	return comparison, nil
+}
+
+// valuesDiffer compares the json form of the values, which is what clients get to see.
+func valuesDiffer(values []interface{}) bool {
+	var first []byte
+	for i, value := range values {
+		encoded, _ := json.Marshal(value)
+		if i == 0 {
+			first = encoded
+		} else if !bytes.Equal(first, encoded) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Service) GetTotalProductCost(variantIds []string) (int, error) {
@@ -45,8 +240,8 @@ func (s *Service) PriceAfterDiscount(price int, couponCode string) (int, error)
 	return s.repo.priceAfterDiscount(price, couponCode)
 }
 
-func (s *Service) FilterMyOrders(userId string, ProductStatus models.DeliveryStatus, limit int, page int) ([]models.Orders, error) {
-	return s.repo.filterMyOrders(userId, ProductStatus, limit, page)
+func (s *Service) FilterMyOrders(userId string, ProductStatus models.DeliveryStatus, params *pagination.Params) ([]models.Orders, error) {
+	return s.repo.filterMyOrders(userId, ProductStatus, params)
 }
 
 func (s *Service) CountFilterMyOrders(userId string, ProductStatus models.DeliveryStatus) (int64, error) {
@@ -57,14 +252,6 @@ func (s *Service) UpdateProductStock(variantId string, stock int) error {
 	return s.repo.updateProductStock(variantId, stock)
 }
 
-func (s *Service) FilterAllProducts(limit int, page int, searchString string, categoryFilter string, brandFilter string) ([]models.AllProducts, error) {
-	return s.repo.filterAllProducts(limit, page, searchString, categoryFilter, brandFilter)
-}
-
-func (s *Service) FilterAllProductsCount(searchString string, categoryFilter string, brandFilter string) (int64, error) {
-	return s.repo.filterAllProductsCount(searchString, categoryFilter, brandFilter)
-}
-
 func (s *Service) GenerateOrderIdByCart(price int, userId string, addressId string) (string, error) {
 	return s.repo.generateOrderIdByCart(price, userId, addressId)
 }
@@ -77,6 +264,153 @@ func (s *Service) GetAllOffers() ([]models.Offer, error) {
 	return s.repo.getAllOffers()
 }
 
+func (s *Service) GetActiveOffers() ([]models.PublicOffer, error) {
+	return s.repo.getActiveOffers()
+}
+
 func (s *Service) AddAddress(userID string, newAddress *models.Address) (string, error) {
 	return s.repo.addAddress(userID, newAddress)
 }
+
+func (s *Service) GetUserById(userID string) (models.Users, error) {
+	return s.repo.getUserById(userID)
+}
+
+func (s *Service) ChangePassword(userID string, sessionID string, hashedPassword string) error {
+	return s.repo.changePassword(userID, sessionID, hashedPassword)
+}
+
+func (s *Service) UpdateProfile(userID string, profile *models.ProfileBody) error {
+	return s.repo.updateProfile(userID, profile)
+}
+
+func (s *Service) EmailInUse(email string) (bool, error) {
+	return s.repo.emailInUse(email)
+}
+
+func (s *Service) CreateEmailChangeToken(userID string, newEmail string) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.createUserToken(userID, models.EmailChange, utils.HashToken(token), newEmail, time.Now().Add(emailChangeValidity))
+	return token, err
+}
+
+func (s *Service) DeleteAccount(userID string) error {
+	return s.repo.deleteAccount(userID)
+}
+
+// CreateDataExport queues building the archive of everything stored about the user, while
+// an export is still being built the same one is returned instead of starting another.
+func (s *Service) CreateDataExport(userID string) (models.DataExport, error) {
+	cutoff := time.Now().Add(-dataExportTimeout)
+	if _, err := s.repo.failActiveDataExports(userID, cutoff, "export timed out"); err != nil {
+		return models.DataExport{}, err
+	}
+
+	export, err := s.repo.getActiveDataExport(userID, cutoff)
+	if err == nil {
+		return export, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return export, err
+	}
+
+	export = models.DataExport{
+		Id:        uuid.New().String(),
+		UserId:    userID,
+		Status:    models.ExportPending,
+		ExpiresAt: time.Now().Add(dataExportRetention),
+	}
+	if err := s.repo.createDataExport(&export); err != nil {
+		return export, err
+	}
+
+	go s.buildDataExport(export.Id, userID)
+	return export, nil
+}
+
+// RecoverDataExports fails the exports that are pending or running for longer than
+// dataExportTimeout, like those of an instance of the app that stopped while building them.
+func (s *Service) RecoverDataExports() (int64, error) {
+	return s.repo.failActiveDataExports("", time.Now().Add(-dataExportTimeout), "export timed out, please request a new one")
+}
+
+func (s *Service) GetDataExport(userID string, exportID string, withArchive bool) (models.DataExport, error) {
+	return s.repo.getDataExport(userID, exportID, withArchive)
+}
+
+func (s *Service) buildDataExport(exportID string, userID string) {
+	started, err := s.repo.updateDataExport(exportID, models.ExportPending, map[string]interface{}{"status": models.ExportRunning})
+	if err != nil {
+		logrus.Errorf("buildDataExport: error in updating export %s err: %v", exportID, err)
+		return
+	}
+	if !started {
+		return
+	}
+
+	archive, err := s.assembleDataExport(userID)
+	updates := map[string]interface{}{
+		"status":       models.ExportCompleted,
+		"completed_at": time.Now(),
+	}
+	if err != nil {
+		logrus.Errorf("buildDataExport: error in assembling export %s err: %v", exportID, err)
+		updates["status"] = models.ExportFailed
+		updates["error"] = err.Error()
+	} else {
+		updates["archive"] = archive
+	}
+
+	saved, err := s.repo.updateDataExport(exportID, models.ExportRunning, updates)
+	if err != nil {
+		logrus.Errorf("buildDataExport: error in saving export %s err: %v", exportID, err)
+	}
+	if err == nil && !saved {
+		logrus.Warnf("buildDataExport: export %s timed out before it was saved", exportID)
+	}
+}
+
+func (s *Service) assembleDataExport(userID string) ([]byte, error) {
+	data, err := s.repo.collectUserData(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{name: "export.json", content: data},
+		{name: "profile.json", content: data.Profile},
+		{name: "addresses.json", content: data.Addresses},
+		{name: "sessions.json", content: data.Sessions},
+		{name: "cart.json", content: data.Cart},
+		{name: "orders.json", content: data.Orders},
+		{name: "reviews.json", content: data.Reviews},
+		{name: "questions.json", content: data.Questions},
+		{name: "answers.json", content: data.Answers},
+	}
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
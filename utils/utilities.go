@@ -1,18 +1,15 @@
 package utils
 
 import (
-	cloud "cloud.google.com/go/storage"
-	"context"
-	firebase "firebase.google.com/go"
-	"github.com/Shresth92/audiophile/models"
-	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/api/option"
 	"os"
-	"strconv"
-	"time"
+	"regexp"
+	"strings"
 )
 
 func LoadEnv() error {
@@ -33,64 +30,33 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// DummyPasswordHash is a hash of the same cost as HashPassword that no password is known
+// for, comparing against it keeps lookups of unknown accounts as slow as real ones.
+const DummyPasswordHash = "$2a$14$l/yVmf56QOUGEVMuw/9ZgOaRmJ/8AjCN3Wpr3tlX3BzaBPgyCZyNS"
+
 func CheckPassword(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
-func GenerateJWTToken(userId string, sessionID string, role models.Roles) (string, error) {
-	expirationTime := time.Now().Add(60 * time.Minute)
-	claims := &models.Claims{
-		UserId:    userId,
-		SessionId: sessionID,
-		Role:      role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
+// GenerateRandomToken returns a url safe random token to be handed out to users,
+// only its HashToken value should be persisted.
+func GenerateRandomToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	JwtKey := []byte(GetEnvValue("JwtKey"))
-	tokenString, err := token.SignedString(JwtKey)
-	return tokenString, err
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
 }
 
-func GetFirebaseClient() (*models.App, error) {
-	client := &models.App{}
-	client.Ctx = context.Background()
-	credentialsFile := option.WithCredentialsJSON([]byte(GetEnvValue("FirebaseConfig")))
-	app, err := firebase.NewApp(client.Ctx, nil, credentialsFile)
-	if err != nil {
-		return client, err
-	}
-
-	client.Client, err = app.Firestore(client.Ctx)
-	if err != nil {
-		return client, err
-	}
-
-	client.Storage, err = cloud.NewClient(client.Ctx, credentialsFile)
-	if err != nil {
-		return client, err
-	}
-
-	return client, nil
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }
 
-func GetLimitPage(ctx *gin.Context) (int, int, error) {
-	var err error
-	limit := 5
-	page := 0
-	limitQuery := ctx.Query("limit")
-	if limitQuery != "" {
-		limit, err = strconv.Atoi(limitQuery)
-		return limit, page, err
-	}
-
-	pageQuery := ctx.Query("page")
-	if pageQuery != "" {
-		page, err = strconv.Atoi(pageQuery)
-		return limit, page, err
-	}
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
 
-	return limit, page, nil
+// Slugify turns a name into the lower case, dash separated form used in urls.
+func Slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
 }